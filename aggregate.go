@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// aggregateQuantiles are the lag quantiles reported by -aggregate-only.
+var aggregateQuantiles = []float64{0.5, 0.9, 0.99}
+
+// poolAggregate emits pool level aggregates in place of the per-image
+// series, for pools where one series per image is too many. A nil
+// aggregate is disabled.
+type poolAggregate struct {
+	descImages *prometheus.Desc
+	descLag    *prometheus.Desc
+	descSync   *prometheus.Desc
+	descSpeed  *prometheus.Desc
+	descLast   *prometheus.Desc
+}
+
+func newPoolAggregate(enabled bool) *poolAggregate {
+	if !enabled {
+		return nil
+	}
+	labels := []string{"pool"}
+	mp := MetricPrefix
+	return &poolAggregate{
+		descImages: prometheus.NewDesc(mp+"pool_mirrored_images", "Mirrored images in the pool by peer state", []string{"pool", "state"}, nil),
+		descLag:    prometheus.NewDesc(mp+"pool_snapshot_lag_seconds", "Gap between the newest primary snapshot and its peer copy over the pool's images (s)", labels, nil),
+		descSync:   prometheus.NewDesc(mp+"pool_snapshot_last_snapshot_sync_seconds_max", "Longest last snapshot sync among the pool's images (s)", labels, nil),
+		descSpeed:  prometheus.NewDesc(mp+"pool_snapshot_speed_bytes_per_second", "Snapshot sync speed summed over the pool's images (bytes/s)", labels, nil),
+		descLast:   prometheus.NewDesc(mp+"pool_snapshot_last_snapshot_bytes", "Last snapshot size transferred summed over the pool's images (bytes)", labels, nil),
+	}
+}
+
+func (a *poolAggregate) Describe(ch chan<- *prometheus.Desc) {
+	if a == nil {
+		return
+	}
+	ch <- a.descImages
+	ch <- a.descLag
+	ch <- a.descSync
+	ch <- a.descSpeed
+	ch <- a.descLast
+}
+
+// poolAggregateRun accumulates one collection.
+type poolAggregateRun struct {
+	a                 *poolAggregate
+	states            map[string]int
+	lags              []float64
+	maxSyncSeconds    float64
+	speed             float64
+	lastSnapshotBytes float64
+}
+
+func (a *poolAggregate) begin() *poolAggregateRun {
+	if a == nil {
+		return nil
+	}
+	return &poolAggregateRun{a: a, states: make(map[string]int)}
+}
+
+// add accounts one image; images without stats only count by state.
+func (r *poolAggregateRun) add(state string, stats snapshotStats, haveStats bool) {
+	if r == nil {
+		return
+	}
+	r.states[state]++
+	if !haveStats {
+		return
+	}
+	r.lags = append(r.lags, stats.lagSeconds())
+	r.maxSyncSeconds = max(r.maxSyncSeconds, stats.LastSnapshotSyncSeconds)
+	r.speed += stats.speed()
+	r.lastSnapshotBytes += stats.LastSnapshotBytes
+}
+
+func (r *poolAggregateRun) collect(pool string, ch chan<- prometheus.Metric) {
+	if r == nil {
+		return
+	}
+	a := r.a
+	for state, n := range r.states {
+		ch <- prometheus.MustNewConstMetric(a.descImages, prometheus.GaugeValue, float64(n), pool, state)
+	}
+	slices.Sort(r.lags)
+	var sum float64
+	for _, l := range r.lags {
+		sum += l
+	}
+	quantiles := make(map[float64]float64, len(aggregateQuantiles))
+	if len(r.lags) > 0 {
+		for _, q := range aggregateQuantiles {
+			// nearest rank
+			quantiles[q] = r.lags[int(math.Ceil(q*float64(len(r.lags))))-1]
+		}
+	}
+	ch <- prometheus.MustNewConstSummary(a.descLag, uint64(len(r.lags)), sum, quantiles, pool)
+	ch <- prometheus.MustNewConstMetric(a.descSync, prometheus.GaugeValue, r.maxSyncSeconds, pool)
+	ch <- prometheus.MustNewConstMetric(a.descSpeed, prometheus.GaugeValue, r.speed, pool)
+	ch <- prometheus.MustNewConstMetric(a.descLast, prometheus.GaugeValue, r.lastSnapshotBytes, pool)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alerts fired by the Alertmanager client
+const (
+	alertSplitBrain = "CephVMSplitBrain"
+	alertImageError = "CephVMImageError"
+)
+
+// amAlert is an alert in the Alertmanager v2 API.
+type amAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// imageCondition is an alertable condition of one image.
+type imageCondition struct {
+	since   time.Time // first seen
+	message string
+}
+
+// amClient sends alerts straight to Alertmanager for split-brain images
+// and images in error for longer than errorFor, collecting on its own
+// schedule, so DR events are not missed while Prometheus is down too.
+// Active alerts are re-sent every interval with an end a few intervals
+// ahead, so that they resolve by themselves if the exporter dies; cleared
+// ones are resolved right away.
+type amClient struct {
+	urls     []string
+	interval time.Duration
+	errorFor time.Duration
+	client   *http.Client
+
+	mu         sync.Mutex
+	conditions map[string]map[string]*imageCondition // alertname -> pool/image
+}
+
+func newAMClient(urls []string, interval, errorFor time.Duration) *amClient {
+	return &amClient{
+		urls:       urls,
+		interval:   interval,
+		errorFor:   errorFor,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		conditions: map[string]map[string]*imageCondition{alertSplitBrain: {}, alertImageError: {}},
+	}
+}
+
+// run evaluates c's collections every interval until ctx ends. Standby
+// replicas stay silent; their leader alerts.
+func (a *amClient) run(ctx context.Context, c *mirrorCollector) {
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if !c.leader.isLeader() {
+			continue
+		}
+		cctx, cancel := context.WithTimeout(ctx, a.interval)
+		col, err := c.collection(cctx)
+		cancel()
+		if err != nil {
+			// no news is not good news, but not a reason to resolve either
+			log.Printf("alertmanager: %v", err)
+			continue
+		}
+		alerts := a.evaluate(c, c.shard.status(col.status), time.Now())
+		if len(alerts) == 0 {
+			continue
+		}
+		pctx, cancel := context.WithTimeout(ctx, a.interval)
+		a.send(pctx, alerts)
+		cancel()
+	}
+}
+
+// evaluate updates the conditions from ps and returns the alerts to send:
+// the active ones and those just resolved.
+func (a *amClient) evaluate(c *mirrorCollector, ps *poolStatus, now time.Time) []amAlert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	found := map[string]map[string]string{alertSplitBrain: {}, alertImageError: {}}
+	for i := range ps.Images {
+		img := &ps.Images[i]
+		if len(img.PeerSites) == 0 {
+			continue
+		}
+		key := c.pool + "/" + img.id()
+		if desc := splitBrainDescription(img); desc != "" {
+			found[alertSplitBrain][key] = desc
+		}
+		if state := c.trackedState(img); isErrorState(state) {
+			found[alertImageError][key] = state
+		}
+	}
+	var alerts []amAlert
+	for name, conds := range a.conditions {
+		for key, cond := range conds {
+			if _, ok := found[name][key]; !ok {
+				delete(conds, key)
+				if a.due(name, cond, now) {
+					alerts = append(alerts, a.alert(name, key, cond, now))
+				}
+			}
+		}
+		for key, msg := range found[name] {
+			cond := conds[key]
+			if cond == nil {
+				cond = &imageCondition{since: now}
+				conds[key] = cond
+			}
+			cond.message = msg
+			if a.due(name, cond, now) {
+				alerts = append(alerts, a.alert(name, key, cond, now.Add(4*a.interval)))
+			}
+		}
+	}
+	return alerts
+}
+
+// due tells whether cond lasted long enough to alert on at now.
+func (a *amClient) due(name string, cond *imageCondition, now time.Time) bool {
+	return name != alertImageError || now.Sub(cond.since) >= a.errorFor
+}
+
+func (a *amClient) alert(name, key string, cond *imageCondition, endsAt time.Time) amAlert {
+	pool, image, _ := strings.Cut(key, "/")
+	summary := fmt.Sprintf("Image %s of pool %s is in split-brain", image, pool)
+	if name == alertImageError {
+		summary = fmt.Sprintf("Image %s of pool %s has been in error for more than %s", image, pool, a.errorFor)
+	}
+	return amAlert{
+		Labels:      map[string]string{"alertname": name, "severity": "critical", "pool": pool, "image": image},
+		Annotations: map[string]string{"summary": summary, "description": cond.message},
+		StartsAt:    cond.since,
+		EndsAt:      endsAt,
+	}
+}
+
+// splitBrainDescription returns the description reporting img to be in
+// split-brain, "" if none does.
+func splitBrainDescription(img *poolImage) string {
+	if strings.Contains(img.Description, "split-brain") {
+		return img.Description
+	}
+	for _, peer := range img.PeerSites {
+		if strings.Contains(peer.Description, "split-brain") {
+			return peer.reason()
+		}
+	}
+	return ""
+}
+
+func (a *amClient) send(ctx context.Context, alerts []amAlert) {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		log.Printf("alertmanager: %v", err)
+		return
+	}
+	for _, url := range a.urls {
+		if err := a.post(ctx, strings.TrimRight(url, "/")+"/api/v2/alerts", body); err != nil {
+			log.Printf("alertmanager %s: %v", url, err)
+		}
+	}
+}
+
+func (a *amClient) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
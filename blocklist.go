@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// blocklistPeerHosts are the hosts of the peer cluster's rbd-mirror
+// daemons, whose clients connect to the local cluster; set by
+// -collector.blocklist.peer-hosts.
+var blocklistPeerHosts []string
+
+// blocklistCollector checks the OSD blocklist for the addresses of the hosts
+// running mirror clients: the local rbd-mirror daemons and the configured
+// peer hosts. A blocklisted client cannot write and replication halts
+// without any error in the mirror status.
+type blocklistCollector struct {
+	descEntries     *prometheus.Desc
+	descBlocklisted *prometheus.Desc
+}
+
+func newBlocklistCollector([]string) poolCollector {
+	mp := MetricPrefix
+	return &blocklistCollector{
+		descEntries:     prometheus.NewDesc(mp+"osd_blocklist_entries", "Client addresses in the OSD blocklist", nil, nil),
+		descBlocklisted: prometheus.NewDesc(mp+"mirror_client_blocklisted", "Whether a client address of the mirror host is in the OSD blocklist (1) or not (0)", []string{"pool", "host"}, nil),
+	}
+}
+
+type blocklistEntry struct {
+	Addr string `json:"addr"`
+}
+
+// blocklist is the collector's data: entry count and, per mirror host,
+// whether one of its addresses is blocklisted.
+type blocklist struct {
+	Entries int             `json:"entries"`
+	Hosts   map[string]bool `json:"hosts"`
+}
+
+func (b *blocklistCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- b.descEntries
+	ch <- b.descBlocklisted
+}
+
+func (b *blocklistCollector) fetch(ctx context.Context, _ string, _ []string, status *poolStatus) (any, error) {
+	raw, err := RunCeph(ctx, "osd", "blocklist", "ls", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var entries []blocklistEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, decodeFailed(err)
+	}
+	listed := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if ip := blocklistIP(e.Addr); ip != "" {
+			listed[ip] = true
+		}
+	}
+	hosts := slices.Clone(blocklistPeerHosts)
+	for _, d := range status.Daemons {
+		if d.Hostname != "" && !slices.Contains(hosts, d.Hostname) {
+			hosts = append(hosts, d.Hostname)
+		}
+	}
+	bl := &blocklist{Entries: len(entries), Hosts: make(map[string]bool, len(hosts))}
+	for _, host := range hosts {
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			// peer hosts may not resolve on this side
+			log.Printf("blocklist: %v", err)
+			continue
+		}
+		bl.Hosts[host] = slices.ContainsFunc(ips, func(ip string) bool { return listed[ip] })
+	}
+	return bl, nil
+}
+
+// blocklistIP returns the IP of a blocklist address such as
+// 10.0.0.1:0/3710147553 or [fd00::1]:0/3710147553.
+func blocklistIP(addr string) string {
+	addr, _, _ = strings.Cut(addr, "/")
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+func (b *blocklistCollector) collect(ch chan<- prometheus.Metric, pool string, data any, _ func(string) []string) {
+	bl := data.(*blocklist)
+	ch <- prometheus.MustNewConstMetric(b.descEntries, prometheus.GaugeValue, float64(bl.Entries))
+	for host, listed := range bl.Hosts {
+		v := 0.0
+		if listed {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(b.descBlocklisted, prometheus.GaugeValue, v, pool, host)
+	}
+}
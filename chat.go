@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// defaultChatTemplate renders notifications for the chat sinks unless
+// -notify.template sets another; it is executed with a notification.
+const defaultChatTemplate = `[{{.Event}}] {{.Pool}}/{{.Image}}: {{.OldState}} -> {{.NewState}} since {{.Since.Format "2006-01-02 15:04:05 MST"}}`
+
+func parseChatTemplate(s string) (*template.Template, error) {
+	t, err := template.New("notify").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("notify.template: %w", err)
+	}
+	// catch references to unknown fields before the first event does
+	if err := t.Execute(&strings.Builder{}, notification{}); err != nil {
+		return nil, fmt.Errorf("notify.template: %w", err)
+	}
+	return t, nil
+}
+
+// rateLimiter allows a number of messages per minute; those over the limit
+// are dropped and counted, so that an outage touching every image posts a
+// few messages rather than hundreds.
+type rateLimiter struct {
+	perMinute int // 0 = unlimited
+
+	mu         sync.Mutex
+	window     time.Time
+	sent       int
+	suppressed int // dropped since the last message went out
+}
+
+// allow tells whether a message may go out at now, and if so how many were
+// dropped before it.
+func (r *rateLimiter) allow(now time.Time) (bool, int) {
+	if r.perMinute <= 0 {
+		return true, 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.window) >= time.Minute {
+		r.window, r.sent = now, 0
+	}
+	if r.sent >= r.perMinute {
+		r.suppressed++
+		return false, 0
+	}
+	r.sent++
+	dropped := r.suppressed
+	r.suppressed = 0
+	return true, dropped
+}
+
+// chatSink renders notifications to text and posts them to a chat service.
+type chatSink struct {
+	service  string
+	tmpl     *template.Template
+	limiter  *rateLimiter
+	client   *http.Client
+	endpoint func() string         // URL to post to
+	body     func(text string) any // JSON payload carrying text
+}
+
+func (c *chatSink) name() string { return c.service }
+
+func (c *chatSink) notify(msg notification) error {
+	ok, dropped := c.limiter.allow(time.Now())
+	if !ok {
+		if Debug.Load() {
+			log.Printf("notify %s: rate limited, dropping %s of %s/%s", c.service, msg.Event, msg.Pool, msg.Image)
+		}
+		return nil
+	}
+	var text strings.Builder
+	if err := c.tmpl.Execute(&text, msg); err != nil {
+		return err
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&text, "\n(%d earlier notifications dropped by rate limiting)", dropped)
+	}
+	body, err := json.Marshal(c.body(text.String()))
+	if err != nil {
+		return err
+	}
+	err = postJSON(c.client, c.endpoint(), body)
+	// the URL holds the webhook secret or bot token, keep it out of the log
+	if uerr := (*url.Error)(nil); errors.As(err, &uerr) {
+		return uerr.Err
+	}
+	return err
+}
+
+// newSlackSink posts to a Slack incoming webhook.
+func newSlackSink(webhookURL string, tmpl *template.Template, perMinute int) *chatSink {
+	return &chatSink{
+		service:  "slack",
+		tmpl:     tmpl,
+		limiter:  &rateLimiter{perMinute: perMinute},
+		client:   &http.Client{Timeout: 10 * time.Second},
+		endpoint: func() string { return webhookURL },
+		body:     func(text string) any { return map[string]string{"text": text} },
+	}
+}
+
+// newTelegramSink sends messages to a Telegram chat through a bot of the
+// Bot API at apiURL; token is called per message, so a token file may
+// rotate.
+func newTelegramSink(apiURL string, token func() string, chatID string, tmpl *template.Template, perMinute int) *chatSink {
+	return &chatSink{
+		service:  "telegram",
+		tmpl:     tmpl,
+		limiter:  &rateLimiter{perMinute: perMinute},
+		client:   &http.Client{Timeout: 10 * time.Second},
+		endpoint: func() string { return strings.TrimRight(apiURL, "/") + "/bot" + token() + "/sendMessage" },
+		body: func(text string) any {
+			return map[string]any{"chat_id": chatID, "text": text, "disable_web_page_preview": true}
+		},
+	}
+}
+
+// notifySinks builds the notification sinks configured by cfg, exiting on
+// an invalid configuration; token files are added to credFiles.
+func notifySinks(cfg *config, credFiles *[]*credentialFile) []notifySink {
+	var sinks []notifySink
+	for _, webhook := range splitList(cfg.webhooks) {
+		sinks = append(sinks, newWebhookSink(webhook))
+	}
+	if cfg.chat.slackURL == "" && cfg.chat.tgToken == "" && cfg.chat.tgTokenFile == "" {
+		return sinks
+	}
+	tmpl, err := parseChatTemplate(cfg.chat.tmpl)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if cfg.chat.slackURL != "" {
+		sinks = append(sinks, newSlackSink(cfg.chat.slackURL, tmpl, cfg.chat.rateLimit))
+	}
+	if cfg.chat.tgToken == "" && cfg.chat.tgTokenFile == "" {
+		return sinks
+	}
+	if cfg.chat.tgChat == "" {
+		log.Fatalf("notify.telegram-token needs -notify.telegram-chat-id")
+	}
+	token := func() string { return cfg.chat.tgToken }
+	if cfg.chat.tgTokenFile != "" {
+		if cfg.chat.tgToken != "" {
+			log.Fatalf("notify.telegram-token and notify.telegram-token-file are mutually exclusive")
+		}
+		f, err := newCredentialFile("notify.telegram-token-file", cfg.chat.tgTokenFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		*credFiles = append(*credFiles, f)
+		token = f.get
+	}
+	return append(sinks, newTelegramSink(cfg.chat.tgAPI, token, cfg.chat.tgChat, tmpl, cfg.chat.rateLimit))
+}
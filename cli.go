@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// command is a subcommand; all of them take the same flags.
+type command struct {
+	name, help string
+	run        func(cfg *config) error
+}
+
+var commands = []command{
+	{"serve", "serve the metrics over HTTP (default)", serve},
+	{"once", "collect once and print the metrics to stdout", runOnce},
+	{"check", "check access to the pool and the -health.* thresholds; exits 1 if either fails", runCheck},
+	{"status", "print the mirroring state of every image", runStatus},
+	{"dry-run", "collect once and print which images would be exported, and why not", runDryRun},
+	{"version", "print the version and build information", runVersion},
+	{"gen-rules", "print Prometheus alerting rules for the exported series", runGenRules},
+}
+
+func lookupCommand(name string) *command {
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i < 0 {
+		return nil
+	}
+	return &commands[i]
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.help)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// oneShot builds the exporter for a command that collects once; detached
+// collectors are served along with the others.
+func oneShot(cfg *config) *exporter {
+	x := newExporter(cfg, false)
+	for _, names := range x.detached {
+		if err := x.poolReg.Register(x.collector.detach(names)); err != nil {
+			log.Fatalf("pool.labels: %v", err)
+		}
+	}
+	return x
+}
+
+func runOnce(cfg *config) error {
+	x := oneShot(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultScrapeTimeout)
+	defer cancel()
+	// the gathering below is served from this collection
+	if err := x.collector.warmUp(ctx); err != nil {
+		return err
+	}
+	mfs, err := x.registry.Gather()
+	if err != nil {
+		return err
+	}
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(os.Stdout, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCheck(cfg *config) error {
+	x := newExporter(cfg, false)
+	if err := x.preflight(cfg); err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultScrapeTimeout)
+	defer cancel()
+	col, err := x.collector.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	vs := x.health.check(cfg.pool, col.status)
+	for _, v := range vs {
+		fmt.Printf("%s/%s: %s: %s\n", v.Pool, v.Image, v.Check, v.Message)
+	}
+	if len(vs) > 0 {
+		return fmt.Errorf("%d threshold violations", len(vs))
+	}
+	fmt.Printf("OK: pool %s, %d images\n", cfg.pool, len(col.status.Images))
+	return nil
+}
+
+func runStatus(cfg *config) error {
+	x := newExporter(cfg, false)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultScrapeTimeout)
+	defer cancel()
+	col, err := x.collector.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	images := slices.Clone(col.status.Images)
+	slices.SortFunc(images, func(a, b poolImage) int { return strings.Compare(a.id(), b.id()) })
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tSTATE\tPEER\tPEER STATE\tLAG\tLAST UPDATE")
+	for i := range images {
+		img := &images[i]
+		if len(img.PeerSites) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t%s\n", img.id(), img.State, img.LastUpdate)
+			continue
+		}
+		for _, peer := range img.PeerSites {
+			lag := "-"
+			if stats, err := peer.stats(); err == nil {
+				lag = (time.Duration(stats.lagSeconds()) * time.Second).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", img.id(), img.State, peer.SiteName, peer.State, lag, peer.LastUpdate)
+		}
+	}
+	return w.Flush()
+}
+
+func runDryRun(cfg *config) error {
+	x := newExporter(cfg, false)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultScrapeTimeout)
+	defer cancel()
+	col, err := x.collector.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	images := slices.Clone(col.status.Images)
+	slices.SortFunc(images, func(a, b poolImage) int { return strings.Compare(a.id(), b.id()) })
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tRESULT\tREASON")
+	for i := range images {
+		outcome, reason := x.collector.explain(&images[i])
+		counts[outcome]++
+		if reason == "" {
+			reason = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", images[i].id(), outcome, reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d images: %d %s, %d %s, %d %s\n", len(images),
+		counts[dryRunExported], dryRunExported, counts[dryRunPartial], dryRunPartial, counts[dryRunSkipped], dryRunSkipped)
+	return nil
+}
+
+func runVersion(*config) error {
+	fmt.Println(buildVersion())
+	return nil
+}
+
+// defaultRuleLag is the lag alerted on when -health.max-lag is not set.
+const defaultRuleLag = time.Hour
+
+// runGenRules prints a Prometheus rule group matching the flags: the
+// series the exporter will emit and the -health.max-lag threshold.
+func runGenRules(cfg *config) error {
+	colPaths, err := parseCollectorPaths(cfg.colPaths)
+	if err != nil {
+		return err
+	}
+	lag := cfg.maxLag
+	if lag <= 0 {
+		lag = defaultRuleLag
+	}
+	type rule struct {
+		name, expr, wait, severity, summary string
+	}
+	mp := MetricPrefix
+	rules := []rule{
+		{"CephVMExporterDown", mp + "up == 0", "10m", "critical",
+			"Mirroring status of pool {{ $labels.pool }} cannot be collected"},
+	}
+	if cfg.aggOnly {
+		rules = append(rules,
+			rule{"CephVMPoolSnapshotLag", fmt.Sprintf(`%spool_snapshot_lag_seconds{quantile="0.99"} > %g`, mp, lag.Seconds()), "15m", "warning",
+				"Images of pool {{ $labels.pool }} lag their primary snapshots by {{ $value | humanizeDuration }}"},
+			rule{"CephVMPoolImagesInError", mp + `pool_mirrored_images{state=~".*error.*"} > 0`, "15m", "critical",
+				"{{ $value }} images of pool {{ $labels.pool }} are in state {{ $labels.state }}"},
+		)
+	} else {
+		rules = append(rules,
+			rule{"CephVMReplicationNotOK", mp + "snapshot_replication_state == 0", "15m", "critical",
+				"Image {{ $labels.image }} of pool {{ $labels.pool }} is {{ $labels.state }}"},
+			rule{"CephVMReplicationStale", fmt.Sprintf("time() - %ssnapshot_last_update_timestamp > %g", mp, lag.Seconds()), "15m", "warning",
+				"Mirror status of image {{ $labels.image }} was last updated {{ $value | humanizeDuration }} ago"},
+		)
+	}
+	if cfg.vmAgg != vmAggregateOff {
+		rules = append(rules, rule{"CephVMSnapshotLag", fmt.Sprintf("%svm_snapshot_lag_seconds > %g", mp, lag.Seconds()), "15m", "warning",
+			"VM {{ $labels.vmid }} lags its primary snapshots by {{ $value | humanizeDuration }}"})
+	}
+	if _, detached := colPaths["blocklist"]; *cfg.poolCols["blocklist"] || detached {
+		rules = append(rules, rule{"CephVMMirrorClientBlocklisted", mp + "mirror_client_blocklisted == 1", "0m", "critical",
+			"A mirror client on {{ $labels.host }} is blocklisted; replication of pool {{ $labels.pool }} is halted"})
+	}
+	if _, detached := colPaths["poolinfo"]; (*cfg.poolCols["poolinfo"] || detached) && cfg.expPeers > 0 {
+		rules = append(rules, rule{"CephVMPoolPeersMissing", mp + "pool_peers_as_expected == 0", "15m", "warning",
+			"Pool {{ $labels.pool }} does not have the expected number of mirroring peers"})
+	}
+	fmt.Printf("groups:\n  - name: ceph_vm_exporter\n    rules:\n")
+	for _, r := range rules {
+		fmt.Printf("      - alert: %s\n        expr: '%s'\n        for: %s\n        labels:\n          severity: %s\n        annotations:\n          summary: '%s'\n",
+			r.name, yamlQuote(r.expr), r.wait, r.severity, yamlQuote(r.summary))
+	}
+	return nil
+}
+
+// yamlQuote escapes s for a single-quoted YAML scalar.
+func yamlQuote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os/exec"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var collectorPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: MetricPrefix + "collector_panics_total",
+	Help: "Panics recovered while collecting, by collector (main for the mirror status series)",
+}, []string{"collector"})
+
+// recoverPanic, deferred in collect paths, logs a panic with its stack and
+// counts it instead of failing the whole scrape; series sent before it
+// are still served.
+func recoverPanic(collector string) {
+	if r := recover(); r != nil {
+		collectorPanics.WithLabelValues(collector).Inc()
+		log.Printf("panic in %s collector: %v\n%s", collector, r, debug.Stack())
+	}
+}
+
+// contextError returns ctx's error if it is done, since a killed rbd only
+// reports the signal.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// errorClass buckets an error for use as a label value.
+func errorClass(err error) string {
+	var exitErr *exec.ExitError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, exec.ErrNotFound):
+		return "not_found"
+	case errors.As(err, &exitErr):
+		return "exit"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return "decode"
+	}
+	return "other"
+}
+
+type collectorError struct {
+	class string
+	at    time.Time
+}
+
+// collectorStatus remembers how the optional collectors fared, so that a
+// failing one can be told apart from a total outage.
+type collectorStatus struct {
+	mu      sync.Mutex
+	success map[string]bool           // outcome of the last run
+	lastErr map[string]collectorError // most recent failure, kept after recovery
+
+	descSuccess *prometheus.Desc
+	descLastErr *prometheus.Desc
+}
+
+func newCollectorStatus() *collectorStatus {
+	mp := MetricPrefix
+	return &collectorStatus{
+		success:     make(map[string]bool),
+		lastErr:     make(map[string]collectorError),
+		descSuccess: prometheus.NewDesc(mp+"collector_success", "Whether the last run of the optional collector succeeded for every image (1) or not (0)", []string{"collector"}, nil),
+		descLastErr: prometheus.NewDesc(mp+"collector_last_error_timestamp_seconds", "Time of the collector's most recent error, by error class (unix)", []string{"collector", "class"}, nil),
+	}
+}
+
+// record notes the outcome of one run; errs maps collector name to its
+// error, nil if it succeeded.
+func (s *collectorStatus) record(errs map[string]error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, err := range errs {
+		s.success[name] = err == nil
+		if err != nil {
+			s.lastErr[name] = collectorError{errorClass(err), now}
+		}
+	}
+}
+
+func (s *collectorStatus) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.descSuccess
+	ch <- s.descLastErr
+}
+
+func (s *collectorStatus) collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, ok := range s.success {
+		v := 0.0
+		if ok {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(s.descSuccess, prometheus.GaugeValue, v, name)
+	}
+	for name, e := range s.lastErr {
+		ch <- prometheus.MustNewConstMetric(s.descLastErr, prometheus.GaugeValue, float64(e.at.Unix()), name, e.class)
+	}
+}
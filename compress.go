@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// -web.compression values besides a size threshold
+const (
+	compressionOn  = "on"
+	compressionOff = "off"
+)
+
+// parseCompression returns the smallest response size to gzip: 0 for on
+// (promhttp's own compression), -1 for off.
+func parseCompression(s string) (int, error) {
+	switch s {
+	case compressionOn:
+		return 0, nil
+	case compressionOff:
+		return -1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("web.compression: %q is neither %s, %s nor a size in bytes", s, compressionOn, compressionOff)
+	}
+	return n, nil
+}
+
+// acceptsGzip tells whether the client accepts gzip-encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			v, err := strconv.ParseFloat(q, 64)
+			return err == nil && v > 0
+		}
+		return true
+	}
+	return false
+}
+
+// bufferedResponse holds a response until it is known whether to compress it.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// gzipAbove serves h's responses gzipped when the client accepts it and they
+// are at least minSize bytes long; compressing small ones costs more CPU
+// than it saves in transfer.
+func gzipAbove(minSize int, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		buf := &bufferedResponse{header: w.Header()}
+		h.ServeHTTP(buf, r)
+		status := buf.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if buf.body.Len() < minSize {
+			w.WriteHeader(status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.WriteHeader(status)
+		gz := gzip.NewWriter(w)
+		gz.Write(buf.body.Bytes())
+		gz.Close()
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// configHash fingerprints the effective configuration so fleet tooling can
+// tell whether two exporters run with the same settings.
+func configHash() string {
+	var lines []string
+	flag.VisitAll(func(f *flag.Flag) {
+		lines = append(lines, f.Name+"="+f.Value.String())
+	})
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// configMetrics reports which configuration is loaded. It is read from
+// the flags once, at startup.
+type configMetrics struct {
+	hash   string
+	source string
+
+	descInfo *prometheus.Desc
+}
+
+func newConfigMetrics(source, hash string) *configMetrics {
+	return &configMetrics{
+		hash:     hash,
+		source:   source,
+		descInfo: prometheus.NewDesc(MetricPrefix+"config_info", "Loaded configuration, identified by hash and source", []string{"hash", "source"}, nil),
+	}
+}
+
+func (m *configMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.descInfo
+}
+
+func (m *configMetrics) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(m.descInfo, prometheus.GaugeValue, 1, m.hash, m.source)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// coverageCollector compares all images of the pool with the mirrored
+// ones, catching new VM disks that were never enabled for mirroring.
+type coverageCollector struct {
+	descImages     *prometheus.Desc
+	descUnmirrored *prometheus.Desc
+	descCoverage   *prometheus.Desc
+}
+
+func newCoverageCollector([]string) poolCollector {
+	mp := MetricPrefix
+	labels := []string{"pool"}
+	return &coverageCollector{
+		descImages:     prometheus.NewDesc(mp+"pool_images", "Images in the pool's scanned namespaces", labels, nil),
+		descUnmirrored: prometheus.NewDesc(mp+"pool_images_unmirrored", "Images without mirroring enabled", labels, nil),
+		descCoverage:   prometheus.NewDesc(mp+"pool_mirroring_coverage_ratio", "Fraction of the pool's images with mirroring enabled", labels, nil),
+	}
+}
+
+type coverage struct {
+	Images     int `json:"images"`
+	Unmirrored int `json:"unmirrored"`
+}
+
+func (cc *coverageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.descImages
+	ch <- cc.descUnmirrored
+	ch <- cc.descCoverage
+}
+
+func (cc *coverageCollector) fetch(ctx context.Context, pool string, namespaces []string, status *poolStatus) (any, error) {
+	ids, err := listImages(ctx, pool, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	mirrored := make(map[string]bool, len(status.Images))
+	for i := range status.Images {
+		mirrored[status.Images[i].id()] = true
+	}
+	cov := &coverage{Images: len(ids)}
+	for _, id := range ids {
+		if !mirrored[id] {
+			cov.Unmirrored++
+		}
+	}
+	return cov, nil
+}
+
+func (cc *coverageCollector) collect(ch chan<- prometheus.Metric, pool string, data any, _ func(string) []string) {
+	cov := data.(*coverage)
+	ratio := 1.0
+	if cov.Images > 0 {
+		ratio = float64(cov.Images-cov.Unmirrored) / float64(cov.Images)
+	}
+	ch <- prometheus.MustNewConstMetric(cc.descImages, prometheus.GaugeValue, float64(cov.Images), pool)
+	ch <- prometheus.MustNewConstMetric(cc.descUnmirrored, prometheus.GaugeValue, float64(cov.Unmirrored), pool)
+	ch <- prometheus.MustNewConstMetric(cc.descCoverage, prometheus.GaugeValue, ratio, pool)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// credentialPoll is how often credential files are checked for changes.
+const credentialPoll = 30 * time.Second
+
+// rbdAuthArgs are the cephx options appended to every rbd invocation.
+// rbd reads the files they name itself, on each run.
+var rbdAuthArgs []string
+
+// credentialFile is a secret kept in a file, such as a Kubernetes secret
+// mount, and re-read when the file changes so that rotating it needs no
+// restart. A failed re-read keeps the previous value.
+type credentialFile struct {
+	name, path string
+
+	mu       sync.Mutex
+	value    []byte
+	lastOK   bool
+	lastLoad time.Time
+}
+
+// newCredentialFile reads path, which must be readable at startup.
+func newCredentialFile(name, path string) (*credentialFile, error) {
+	f := &credentialFile{name: name, path: path}
+	if err := f.reload(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, nil
+}
+
+// get returns the current value without surrounding whitespace.
+func (f *credentialFile) get() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return string(bytes.TrimSpace(f.value))
+}
+
+func (f *credentialFile) reload() error {
+	raw, err := os.ReadFile(f.path)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastOK = err == nil
+	if err != nil {
+		return err
+	}
+	if f.value != nil && !bytes.Equal(raw, f.value) {
+		log.Printf("%s: reloaded %s", f.name, f.path)
+	}
+	f.value = raw
+	f.lastLoad = time.Now()
+	return nil
+}
+
+// watch re-reads the file every credentialPoll until ctx is done.
+func (f *credentialFile) watch(ctx context.Context) {
+	t := time.NewTicker(credentialPoll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := f.reload(); err != nil {
+			log.Printf("%s: %v (keeping the previous value)", f.name, err)
+		}
+	}
+}
+
+// credentialMetrics reports whether the credential files could be read.
+type credentialMetrics struct {
+	files []*credentialFile
+
+	descLoadOK    *prometheus.Desc
+	descLoadStamp *prometheus.Desc
+}
+
+func newCredentialMetrics(files []*credentialFile) *credentialMetrics {
+	mp := MetricPrefix
+	return &credentialMetrics{
+		files:         files,
+		descLoadOK:    prometheus.NewDesc(mp+"credential_last_load_successful", "Whether the credential file could be read the last time (1=OK, 0=failed)", []string{"credential"}, nil),
+		descLoadStamp: prometheus.NewDesc(mp+"credential_last_load_success_timestamp_seconds", "Timestamp of the last successful credential file read (unix)", []string{"credential"}, nil),
+	}
+}
+
+func (m *credentialMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.descLoadOK
+	ch <- m.descLoadStamp
+}
+
+func (m *credentialMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, f := range m.files {
+		f.mu.Lock()
+		ok := 0.0
+		if f.lastOK {
+			ok = 1.0
+		}
+		stamp := f.lastLoad
+		f.mu.Unlock()
+		ch <- prometheus.MustNewConstMetric(m.descLoadOK, prometheus.GaugeValue, ok, f.name)
+		ch <- prometheus.MustNewConstMetric(m.descLoadStamp, prometheus.GaugeValue, float64(stamp.Unix()), f.name)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// diagDump is the diagnostic snapshot written on SIGUSR1.
+type diagDump struct {
+	Time    time.Time         `json:"time"`
+	Version string            `json:"version"`
+	Config  map[string]string `json:"config"`
+	Pool    poolDump          `json:"pool"`
+	Tracker json.RawMessage   `json:"tracker"`
+}
+
+type poolDump struct {
+	Name           string      `json:"name"`
+	LastCollection time.Time   `json:"last_collection"`
+	LastError      string      `json:"last_error,omitempty"`
+	Status         *poolStatus `json:"status"`
+	// data of the enabled image collectors, by collector and image
+	PerImage map[string]map[string]any `json:"per_image,omitempty"`
+	PerPool  map[string]any            `json:"per_pool,omitempty"`
+}
+
+// secretFlagWords mark flags whose values must not be shown.
+var secretFlagWords = []string{"password", "secret", "token", "key", "webhook", "rbd.env"}
+
+// redactedConfig returns every flag with its current value, secrets replaced.
+func redactedConfig() map[string]string {
+	cfg := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		if v != "" && isSecretFlag(f.Name) {
+			v = "<redacted>"
+		}
+		cfg[f.Name] = redactURLs(v)
+	})
+	return cfg
+}
+
+func isSecretFlag(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range secretFlagWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURLs strips the secrets from the URLs in a flag value, which may
+// be a comma-separated list: passwords, user names standing in for tokens,
+// and query parameters named like secret flags or carrying auth data.
+func redactURLs(v string) string {
+	parts := strings.Split(v, ",")
+	for i, p := range parts {
+		u, err := url.Parse(strings.TrimSpace(p))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			continue
+		}
+		if u.User != nil {
+			if _, ok := u.User.Password(); !ok {
+				u.User = url.User("xxxxx")
+			}
+		}
+		if u.RawQuery != "" {
+			q := u.Query()
+			for name := range q {
+				if l := strings.ToLower(name); isSecretFlag(l) || strings.Contains(l, "auth") || l == "sig" {
+					q.Del(name)
+				}
+			}
+			u.RawQuery = q.Encode()
+		}
+		parts[i] = u.Redacted()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c *mirrorCollector) dump() poolDump {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := poolDump{Name: c.pool, LastCollection: c.lastTime}
+	if c.last != nil {
+		d.Status = c.last.status
+		d.PerImage = c.last.perImage
+		d.PerPool = c.last.perPool
+	}
+	if c.lastErr != nil {
+		d.LastError = c.lastErr.Error()
+	}
+	return d
+}
+
+// writeDump writes the exporter's internal state to path, or to the log if
+// path is empty.
+func writeDump(path string, c *mirrorCollector) {
+	tracker, err := c.tracker.marshal()
+	if err != nil {
+		log.Printf("dump: %v", err)
+		return
+	}
+	raw, err := json.MarshalIndent(diagDump{
+		Time:    time.Now(),
+		Version: Version,
+		Config:  redactedConfig(),
+		Pool:    c.dump(),
+		Tracker: tracker,
+	}, "", "  ")
+	if err != nil {
+		log.Printf("dump: %v", err)
+		return
+	}
+	if path == "" {
+		log.Printf("state dump:\n%s", raw)
+		return
+	}
+	if err := writeFileAtomic(path, raw); err != nil {
+		log.Printf("dump: %v", err)
+		return
+	}
+	log.Printf("state dumped to %s", path)
+}
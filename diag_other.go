@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// notifyDump is a no-op where SIGUSR1 does not exist.
+func notifyDump(dump func()) {}
+
+// notifyLogToggle is a no-op where SIGUSR2 does not exist.
+func notifyLogToggle() {}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyDump calls dump every time the process receives SIGUSR1.
+func notifyDump(dump func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		for range ch {
+			dump()
+		}
+	}()
+}
+
+// notifyLogToggle toggles the log level every time the process receives
+// SIGUSR2.
+func notifyLogToggle() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR2)
+	go func() {
+		for range ch {
+			toggleLogLevel()
+		}
+	}()
+}
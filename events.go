@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// stateChange is a replication state transition of one image between two
+// collections.
+type stateChange struct {
+	Pool     string    `json:"pool"`
+	Image    string    `json:"image"`
+	OldState string    `json:"old_state"` // empty for new images
+	NewState string    `json:"new_state"` // empty for removed images
+	Time     time.Time `json:"time"`
+}
+
+// stateChanges compares two collections of pool by the state function
+// returns for each image. With no previous collection there is nothing to
+// compare against and no change is reported.
+func stateChanges(pool string, prev, cur *poolStatus, now time.Time, state func(*poolImage) string) []stateChange {
+	if prev == nil || cur == nil {
+		return nil
+	}
+	old := make(map[string]string, len(prev.Images))
+	for i := range prev.Images {
+		old[prev.Images[i].id()] = state(&prev.Images[i])
+	}
+	var changes []stateChange
+	for i := range cur.Images {
+		img := &cur.Images[i]
+		id, st := img.id(), state(img)
+		was, existed := old[id]
+		delete(old, id)
+		if existed && was == st {
+			continue
+		}
+		changes = append(changes, stateChange{Pool: pool, Image: id, OldState: was, NewState: st, Time: now})
+	}
+	for id, was := range old {
+		changes = append(changes, stateChange{Pool: pool, Image: id, OldState: was, Time: now})
+	}
+	return changes
+}
+
+// stateBroker fans state changes out to subscribers. Slow subscribers miss
+// events rather than block collections. A nil broker drops everything.
+type stateBroker struct {
+	mu   sync.Mutex
+	subs map[chan stateChange]struct{}
+}
+
+func newStateBroker() *stateBroker {
+	return &stateBroker{subs: make(map[chan stateChange]struct{})}
+}
+
+func (b *stateBroker) publish(changes []stateChange) {
+	if b == nil || len(changes) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		for _, c := range changes {
+			select {
+			case ch <- c:
+			default:
+			}
+		}
+	}
+}
+
+// subscribe returns a channel of future changes and a function that ends
+// the subscription.
+func (b *stateBroker) subscribe() (<-chan stateChange, func()) {
+	ch := make(chan stateChange, 256)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
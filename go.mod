@@ -2,15 +2,21 @@ module github.com/kotloki/ceph_vm_exporter
 
 go 1.23.8
 
-require github.com/prometheus/client_golang v1.22.0
+require (
+	github.com/prometheus/client_golang v1.22.0
+	github.com/prometheus/client_model v0.6.1
+	github.com/prometheus/common v0.62.0
+	golang.org/x/text v0.22.0
+	google.golang.org/grpc v1.72.0
+	google.golang.org/protobuf v1.36.5
+)
 
 require (
-        github.com/beorn7/perks v1.0.1 // indirect
-        github.com/cespare/xxhash/v2 v2.3.0 // indirect
-        github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
-        github.com/prometheus/client_model v0.6.1 // indirect
-        github.com/prometheus/common v0.62.0 // indirect
-        github.com/prometheus/procfs v0.15.1 // indirect
-        golang.org/x/sys v0.30.0 // indirect
-        google.golang.org/protobuf v1.36.5 // indirect
-)
\ No newline at end of file
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a // indirect
+)
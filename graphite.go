@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteOutput sends samples to a Graphite plaintext listener (carbon).
+type graphiteOutput struct {
+	address string
+	prefix  string
+}
+
+func newGraphiteOutput(address, prefix string) *graphiteOutput {
+	return &graphiteOutput{address: address, prefix: strings.Trim(prefix, ".")}
+}
+
+// graphiteSanitize keeps a path component free of separators and characters
+// carbon mishandles.
+func graphiteSanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// dottedPath builds prefix.name.label1.value1.label2.value2..., skipping
+// empty labels, with labels in name order.
+func dottedPath(prefix string, s sample, labels bool) string {
+	var b strings.Builder
+	if prefix != "" {
+		b.WriteString(prefix)
+		b.WriteByte('.')
+	}
+	b.WriteString(graphiteSanitize(s.name))
+	if !labels {
+		return b.String()
+	}
+	for _, l := range s.labels {
+		if l.GetValue() == "" {
+			continue
+		}
+		b.WriteByte('.')
+		b.WriteString(graphiteSanitize(l.GetName()))
+		b.WriteByte('.')
+		b.WriteString(graphiteSanitize(l.GetValue()))
+	}
+	return b.String()
+}
+
+func (o *graphiteOutput) push(ctx context.Context, now time.Time, samples []sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	ts := strconv.FormatInt(now.Unix(), 10)
+	for _, s := range samples {
+		b.WriteString(dottedPath(o.prefix, s, true))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(ts)
+		b.WriteByte('\n')
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", o.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	_, err = conn.Write(b.Bytes())
+	return err
+}
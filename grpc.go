@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/kotloki/ceph_vm_exporter/statuspb"
+)
+
+// statusServer serves the last collection over gRPC.
+type statusServer struct {
+	statuspb.UnimplementedMirrorStatusServer
+	collector *mirrorCollector
+	events    *stateBroker
+}
+
+func serveGRPC(addr string, c *mirrorCollector, events *stateBroker, opts ...grpc.ServerOption) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("grpc listen: %w", err)
+	}
+	srv := grpc.NewServer(opts...)
+	statuspb.RegisterMirrorStatusServer(srv, &statusServer{collector: c, events: events})
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			log.Printf("gRPC server failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// images returns the last collection of the collector's pool, unless pool
+// asks for another one.
+func (s *statusServer) images(pool string) []*statuspb.ImageStatus {
+	c := s.collector
+	if pool != "" && pool != c.pool {
+		return nil
+	}
+	c.mu.Lock()
+	col, at := c.last, c.lastOK
+	c.mu.Unlock()
+	if col == nil {
+		return nil
+	}
+	out := make([]*statuspb.ImageStatus, 0, len(col.status.Images))
+	for i := range col.status.Images {
+		out = append(out, imageStatusPB(c.pool, &col.status.Images[i], at))
+	}
+	return out
+}
+
+func (s *statusServer) ListImages(ctx context.Context, req *statuspb.ListImagesRequest) (*statuspb.ListImagesResponse, error) {
+	return &statuspb.ListImagesResponse{Images: s.images(req.GetPool())}, nil
+}
+
+func (s *statusServer) GetImageStatus(ctx context.Context, req *statuspb.GetImageStatusRequest) (*statuspb.ImageStatus, error) {
+	for _, img := range s.images(req.GetPool()) {
+		if img.Image == req.GetImage() {
+			return img, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "image %s/%s not found", req.GetPool(), req.GetImage())
+}
+
+func (s *statusServer) WatchStateChanges(req *statuspb.WatchStateChangesRequest, stream grpc.ServerStreamingServer[statuspb.StateChange]) error {
+	ch, cancel := s.events.subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case c := <-ch:
+			if req.GetPool() != "" && req.GetPool() != c.Pool {
+				continue
+			}
+			err := stream.Send(&statuspb.StateChange{
+				Pool:     c.Pool,
+				Image:    c.Image,
+				OldState: c.OldState,
+				NewState: c.NewState,
+				Time:     timestamppb.New(c.Time),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func imageStatusPB(pool string, img *poolImage, at time.Time) *statuspb.ImageStatus {
+	st := &statuspb.ImageStatus{
+		Pool:        pool,
+		Image:       img.id(),
+		State:       img.State,
+		Description: img.Description,
+		CollectedAt: timestamppb.New(at),
+	}
+	for _, p := range img.PeerSites {
+		peer := &statuspb.PeerStatus{SiteName: p.SiteName, State: p.State, Description: p.Description}
+		if t, err := time.Parse("2006-01-02 15:04:05", p.LastUpdate); err == nil {
+			peer.LastUpdate = timestamppb.New(t)
+		}
+		if stats, err := p.stats(); err == nil {
+			peer.Stats = &statuspb.SnapshotStats{
+				BytesPerSecond:          stats.BytesPerSecond,
+				BytesPerSnapshot:        stats.BytesPerSnapshot,
+				LastSnapshotBytes:       stats.LastSnapshotBytes,
+				LastSnapshotSyncSeconds: stats.LastSnapshotSyncSeconds,
+				LocalSnapshotTimestamp:  int64(stats.LocalSnapshotTimestamp),
+				RemoteSnapshotTimestamp: int64(stats.RemoteSnapshotTimestamp),
+			}
+		}
+		st.Peers = append(st.Peers, peer)
+	}
+	return st
+}
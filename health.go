@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthThresholds are the limits checked after every collection; zero
+// values disable a check.
+type healthThresholds struct {
+	maxLag          time.Duration
+	minSpeedMiB     float64
+	forbiddenStates []string
+}
+
+type violation struct {
+	Pool    string `json:"pool"`
+	Image   string `json:"image"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+type healthReport struct {
+	Healthy    bool        `json:"healthy"`
+	CheckedAt  time.Time   `json:"checked_at"`
+	Error      string      `json:"error,omitempty"`
+	Violations []violation `json:"violations,omitempty"`
+}
+
+// healthChecker holds the verdict of the latest threshold evaluation,
+// served on /health/replication. A nil checker evaluates nothing.
+type healthChecker struct {
+	th       healthThresholds
+	siteRole string // -site-role, which states the checks look at
+
+	mu     sync.Mutex
+	report healthReport
+}
+
+func newHealthChecker(th healthThresholds, siteRole string) *healthChecker {
+	return &healthChecker{th: th, siteRole: siteRole}
+}
+
+// evaluate checks a collection of pool; err is the collection's error.
+func (h *healthChecker) evaluate(pool string, ps *poolStatus, err error) {
+	if h == nil {
+		return
+	}
+	r := healthReport{CheckedAt: time.Now()}
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Violations = h.check(pool, ps)
+		r.Healthy = len(r.Violations) == 0
+	}
+	h.mu.Lock()
+	h.report = r
+	h.mu.Unlock()
+}
+
+func (h *healthChecker) check(pool string, ps *poolStatus) []violation {
+	var vs []violation
+	add := func(img *poolImage, check, format string, args ...any) {
+		vs = append(vs, violation{Pool: pool, Image: img.id(), Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+	for i := range ps.Images {
+		img := &ps.Images[i]
+		if len(img.PeerSites) == 0 {
+			continue
+		}
+		// like replicationState: the peers replay the images of the primary
+		// site, the local rbd-mirror those of the secondary, whose peers
+		// report up+stopped
+		if h.siteRole == siteRoleSecondary {
+			if h.forbidden(img.State) {
+				add(img, "state", "image is %s", img.State)
+			}
+		} else {
+			for _, peer := range img.PeerSites {
+				if h.forbidden(peer.State) {
+					add(img, "state", "peer %s is %s", peer.SiteName, peer.State)
+				}
+			}
+		}
+		stats, err := img.PeerSites[0].stats()
+		if err != nil {
+			continue
+		}
+		if lag := time.Duration(stats.lagSeconds()) * time.Second; h.th.maxLag > 0 && lag > h.th.maxLag {
+			add(img, "lag", "lag %s exceeds %s", lag, h.th.maxLag)
+		}
+		if speed := stats.speedMiB(); h.th.minSpeedMiB > 0 && stats.LastSnapshotSyncSeconds > 0 && speed < h.th.minSpeedMiB {
+			add(img, "speed", "sync speed %.2f MiB/s below %.2f MiB/s", speed, h.th.minSpeedMiB)
+		}
+	}
+	return vs
+}
+
+// forbidden tells whether state matches one of -health.forbidden-states.
+func (h *healthChecker) forbidden(state string) bool {
+	for _, f := range h.th.forbiddenStates {
+		if strings.Contains(state, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP answers 200 while the last evaluation passed and 503 with the
+// reasons otherwise.
+func (h *healthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	report := h.report
+	h.mu.Unlock()
+	if report.CheckedAt.IsZero() {
+		report.Error = "no collection yet"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("health: %v", err)
+	}
+}
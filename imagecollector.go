@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// imageCollector is an optional collector running rbd once per mirrored
+// image, enabled with -collector.<name>. Fetching happens during the
+// refresh, so results are cached together with the pool status.
+type imageCollector interface {
+	Describe(ch chan<- *prometheus.Desc)
+	// fetch gathers the data for one image; spec is pool/[namespace/]image.
+	fetch(ctx context.Context, spec string) (any, error)
+	// collect emits the series for one image's data; labels are the
+	// per-image label values (pool, image, labeler labels).
+	collect(ch chan<- prometheus.Metric, labels []string, data any)
+}
+
+type imageCollectorInfo struct {
+	name string
+	help string
+	new  func(labels []string) imageCollector
+}
+
+// imageCollectors lists the available per-image collectors, all off by
+// default since each costs one rbd process per image and refresh.
+var imageCollectors = []imageCollectorInfo{
+	{"snapshots", "mirror snapshot (rbd snap ls --all)", newSnapshotCollector},
+	{"watchers", "watcher count (rbd status)", newWatcherCollector},
+	{"locks", "lock owner (rbd lock ls)", newLockCollector},
+	{"children", "clone count (rbd children)", newChildrenCollector},
+	{"usage", "image and snapshot space usage (rbd du)", newUsageCollector},
+	{"info", "image flags and timestamps (rbd info)", newInfoCollector},
+	{"meta", "image-meta values (rbd image-meta list)", newMetaCollector},
+	{"qos", "QoS limit (rbd config image list)", newQoSCollector},
+}
+
+// trackedCollector is an image collector keeping per-image state in the
+// sync tracker, which forgets it with the image and saves it to -state.file.
+type trackedCollector interface {
+	useTracker(t *syncTracker)
+}
+
+type namedImageCollector struct {
+	name string
+	imageCollector
+}
+
+func newImageCollectors(enabled map[string]bool, labels []string, tracker *syncTracker) []namedImageCollector {
+	var out []namedImageCollector
+	for _, info := range imageCollectors {
+		if enabled[info.name] {
+			ic := info.new(labels)
+			if tc, ok := ic.(trackedCollector); ok {
+				tc.useTracker(tracker)
+			}
+			out = append(out, namedImageCollector{info.name, ic})
+		}
+	}
+	return out
+}
+
+// runRBDJSON runs rbd and decodes its JSON output into v as it is printed.
+func runRBDJSON(ctx context.Context, v any, args ...string) error {
+	return streamCephTool(ctx, "rbd", args, func(stdout io.Reader) error {
+		return decodeJSONStream(args, stdout, v)
+	})
+}
+
+// fetchPerImage runs cols for every image with peers in the collector's
+// shard. The result maps collector name to image id to data; images whose
+// fetch failed are left out. errs has an entry for every collector, the
+// last error it ran into or nil.
+func (c *mirrorCollector) fetchPerImage(ctx context.Context, cols []namedImageCollector, images []poolImage) (out map[string]map[string]any, errs map[string]error) {
+	images = c.shard.images(images)
+	out = make(map[string]map[string]any, len(cols))
+	errs = make(map[string]error, len(cols))
+	for _, ic := range cols {
+		out[ic.name] = make(map[string]any, len(images))
+		errs[ic.name] = nil
+	}
+	var mu sync.Mutex
+	forEachImage(ctx, images, func(ctx context.Context, img *poolImage) {
+		spec := c.imageSpec(img)
+		for _, ic := range cols {
+			data, err := ic.fetch(ctx, spec)
+			mu.Lock()
+			if err != nil {
+				log.Printf("%s collector %s: %v", ic.name, spec, err)
+				errs[ic.name] = contextError(ctx, err)
+			} else {
+				out[ic.name][img.id()] = data
+			}
+			mu.Unlock()
+		}
+	})
+	return out, errs
+}
+
+// collectPerImage emits the series of cols from perImage; series has the
+// images' labels if the refresh built them, nil otherwise.
+func (c *mirrorCollector) collectPerImage(cols []namedImageCollector, perImage map[string]map[string]any, series map[string]*imageSeries, ch chan<- prometheus.Metric) {
+	for _, ic := range cols {
+		func() {
+			defer recoverPanic(ic.name)
+			for id, data := range perImage[ic.name] {
+				ic.collect(ch, c.labelValues(series, id), data)
+			}
+		}()
+	}
+}
+
+// imageSpec is the pool/[namespace/]image spec rbd expects.
+func (c *mirrorCollector) imageSpec(img *poolImage) string {
+	return c.pool + "/" + img.id()
+}
+
+// watcherCollector counts the clients watching each image, i.e. the VMs
+// that have the disk open.
+type watcherCollector struct {
+	descWatchers *prometheus.Desc
+}
+
+func newWatcherCollector(labels []string) imageCollector {
+	return &watcherCollector{
+		descWatchers: prometheus.NewDesc(MetricPrefix+"image_watchers", "Number of clients watching the image", labels, nil),
+	}
+}
+
+type imageStatus struct {
+	Watchers []struct {
+		Address string `json:"address"`
+		Client  int64  `json:"client"`
+	} `json:"watchers"`
+}
+
+func (w *watcherCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- w.descWatchers
+}
+
+func (w *watcherCollector) fetch(ctx context.Context, spec string) (any, error) {
+	var st imageStatus
+	err := runRBDJSON(ctx, &st, "status", spec, "--format", "json")
+	return &st, err
+}
+
+func (w *watcherCollector) collect(ch chan<- prometheus.Metric, labels []string, data any) {
+	st := data.(*imageStatus)
+	ch <- prometheus.MustNewConstMetric(w.descWatchers, prometheus.GaugeValue, float64(len(st.Watchers)), labels...)
+}
+
+// childrenCollector counts the clones of each image's snapshots; templates
+// with many clones can neither be removed nor demoted easily.
+type childrenCollector struct {
+	descChildren *prometheus.Desc
+}
+
+func newChildrenCollector(labels []string) imageCollector {
+	return &childrenCollector{
+		descChildren: prometheus.NewDesc(MetricPrefix+"image_children", "Number of images cloned from the image's snapshots", labels, nil),
+	}
+}
+
+type imageChild struct {
+	Pool      string `json:"pool"`
+	Namespace string `json:"pool_namespace"`
+	Image     string `json:"image"`
+}
+
+func (cc *childrenCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.descChildren
+}
+
+func (cc *childrenCollector) fetch(ctx context.Context, spec string) (any, error) {
+	var children []imageChild
+	err := runRBDJSON(ctx, &children, "children", spec, "--format", "json")
+	return children, err
+}
+
+func (cc *childrenCollector) collect(ch chan<- prometheus.Metric, labels []string, data any) {
+	children := data.([]imageChild)
+	ch <- prometheus.MustNewConstMetric(cc.descChildren, prometheus.GaugeValue, float64(len(children)), labels...)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// parseImageList parses -images, pool/[namespace/]image specs, into the
+// image names by namespace. Each exporter watches one pool, and the
+// namespaces must be scanned ones.
+func parseImageList(s, pool string, namespaces []string) (map[string][]string, error) {
+	images := make(map[string][]string)
+	for _, spec := range splitList(s) {
+		parts := strings.Split(spec, "/")
+		if len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("images: %q is not pool/[namespace/]image", spec)
+		}
+		if parts[0] != pool {
+			return nil, fmt.Errorf("images: %s is not in pool %s", spec, pool)
+		}
+		ns, name := "", parts[len(parts)-1]
+		if len(parts) == 3 {
+			ns = parts[1]
+			if !slices.Contains(namespaces, ns) {
+				return nil, fmt.Errorf("images: namespace of %s is not in -namespaces", spec)
+			}
+		}
+		if !slices.Contains(images[ns], name) {
+			images[ns] = append(images[ns], name)
+		}
+	}
+	return images, nil
+}
+
+// imageListSource reads the status of the listed images one by one with
+// rbd mirror image status, in place of the status of the whole pool. With
+// a few critical disks in a large pool that is much cheaper; the summary
+// is made up from the listed images and rbd-mirror daemons are unknown.
+func imageListSource(images map[string][]string) func(ctx context.Context, pool, namespace string) (*poolStatus, error) {
+	return func(ctx context.Context, pool, namespace string) (*poolStatus, error) {
+		names := images[namespace]
+		ps := &poolStatus{Images: make([]poolImage, len(names)), Summary: poolSummary{States: make(map[string]int)}}
+		prefix := pool + "/"
+		if namespace != "" {
+			prefix += namespace + "/"
+		}
+		var mu sync.Mutex
+		var firstErr error
+		forEach(ctx, len(names), func(ctx context.Context, i int) {
+			err := runRBDJSON(ctx, &ps.Images[i], "mirror", "image", "status", prefix+names[i], "--format", "json")
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("mirror image status %s: %w", prefix+names[i], err)
+				}
+				mu.Unlock()
+			}
+		})
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		for i := range ps.Images {
+			// the summary counts states without the daemon's up/down
+			state := ps.Images[i].State
+			if _, s, ok := strings.Cut(state, "+"); ok {
+				state = s
+			}
+			ps.Summary.States[state]++
+		}
+		return ps, nil
+	}
+}
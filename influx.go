@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxOutput writes samples to an InfluxDB v2 write endpoint.
+type influxOutput struct {
+	writeURL string
+	token    func() string
+	client   *http.Client
+}
+
+func newInfluxOutput(baseURL, org, bucket string, token func() string) (*influxOutput, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("influx.url: %w", err)
+	}
+	if org == "" || bucket == "" {
+		return nil, fmt.Errorf("influx.org and influx.bucket are required")
+	}
+	u = u.JoinPath("api", "v2", "write")
+	u.RawQuery = url.Values{"org": {org}, "bucket": {bucket}, "precision": {"s"}}.Encode()
+	return &influxOutput{writeURL: u.String(), token: token, client: &http.Client{}}, nil
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// lineProtocol renders samples as InfluxDB line protocol: the metric name is
+// the measurement, labels are tags and the value is the "value" field.
+func lineProtocol(samples []sample, now time.Time) []byte {
+	var b bytes.Buffer
+	ts := strconv.FormatInt(now.Unix(), 10)
+	for _, s := range samples {
+		b.WriteString(influxMeasurementEscaper.Replace(s.name))
+		for _, l := range s.labels {
+			if l.GetValue() == "" {
+				continue
+			}
+			b.WriteByte(',')
+			b.WriteString(influxTagEscaper.Replace(l.GetName()))
+			b.WriteByte('=')
+			b.WriteString(influxTagEscaper.Replace(l.GetValue()))
+		}
+		b.WriteString(" value=")
+		b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(ts)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+func (o *influxOutput) push(ctx context.Context, now time.Time, samples []sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.writeURL, bytes.NewReader(lineProtocol(samples, now)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token := o.token(); token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("write: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
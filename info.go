@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// knownImageFlags are always exported, so that alerts can match on 0 too.
+var knownImageFlags = []string{"object_map_invalid", "fast_diff_invalid"}
+
+// infoCollector reports image properties from rbd info.
+type infoCollector struct {
+	descFlag     *prometheus.Desc
+	descCreated  *prometheus.Desc
+	descAccessed *prometheus.Desc
+	descModified *prometheus.Desc
+}
+
+func newInfoCollector(labels []string) imageCollector {
+	mp := MetricPrefix
+	return &infoCollector{
+		descFlag:     prometheus.NewDesc(mp+"image_flag", "Image flag set (1) or clear (0); invalid object maps slow down snapshot diffs", append(labels[:len(labels):len(labels)], "flag"), nil),
+		descCreated:  prometheus.NewDesc(mp+"image_create_timestamp_seconds", "Image creation time (unix)", labels, nil),
+		descAccessed: prometheus.NewDesc(mp+"image_access_timestamp_seconds", "Last image access time (unix)", labels, nil),
+		descModified: prometheus.NewDesc(mp+"image_modify_timestamp_seconds", "Last image modification time (unix)", labels, nil),
+	}
+}
+
+// rbdImageInfo is the part of `rbd info --format json` the exporter uses.
+type rbdImageInfo struct {
+	Flags           []string `json:"flags"`
+	CreateTimestamp string   `json:"create_timestamp"`
+	AccessTimestamp string   `json:"access_timestamp"`
+	ModifyTimestamp string   `json:"modify_timestamp"`
+}
+
+// parseRBDTime parses the ctime(3) style timestamps rbd prints in the
+// host's local time; ok is false for missing or malformed values.
+func parseRBDTime(s string) (t time.Time, ok bool) {
+	t, err := time.ParseInLocation(time.ANSIC, strings.TrimSpace(s), time.Local)
+	return t, err == nil
+}
+
+// flagName turns an rbd flag ("object map invalid") into a label value.
+func flagName(f string) string {
+	return strings.ReplaceAll(strings.TrimSpace(f), " ", "_")
+}
+
+func (i *infoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- i.descFlag
+	ch <- i.descCreated
+	ch <- i.descAccessed
+	ch <- i.descModified
+}
+
+func (i *infoCollector) fetch(ctx context.Context, spec string) (any, error) {
+	var info rbdImageInfo
+	err := runRBDJSON(ctx, &info, "info", spec, "--format", "json")
+	return &info, err
+}
+
+func (i *infoCollector) collect(ch chan<- prometheus.Metric, labels []string, data any) {
+	info := data.(*rbdImageInfo)
+	set := make(map[string]bool, len(info.Flags))
+	for _, f := range info.Flags {
+		set[flagName(f)] = true
+	}
+	flagLabels := append(labels[:len(labels):len(labels)], "")
+	emit := func(flag string, v float64) {
+		flagLabels[len(flagLabels)-1] = flag
+		ch <- prometheus.MustNewConstMetric(i.descFlag, prometheus.GaugeValue, v, flagLabels...)
+	}
+	for _, f := range knownImageFlags {
+		v := 0.0
+		if set[f] {
+			v = 1
+		}
+		emit(f, v)
+		delete(set, f)
+	}
+	for f := range set {
+		emit(f, 1)
+	}
+	// access and modify times are only tracked by recent releases
+	for _, ts := range []struct {
+		desc  *prometheus.Desc
+		value string
+	}{
+		{i.descCreated, info.CreateTimestamp},
+		{i.descAccessed, info.AccessTimestamp},
+		{i.descModified, info.ModifyTimestamp},
+	} {
+		if t, ok := parseRBDTime(ts.value); ok {
+			ch <- prometheus.MustNewConstMetric(ts.desc, prometheus.GaugeValue, float64(t.Unix()), labels...)
+		}
+	}
+}
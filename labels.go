@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/text/unicode/norm"
+)
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// reservedLabels are label names used by all of the exporter's per-image
+// series; checkLabelNames catches those of the enabled collectors.
+var reservedLabels = map[string]bool{"pool": true, "image": true, "state": true}
+
+// validLabelName reports whether name can be used as an extra label.
+func validLabelName(name string) bool {
+	return name != "" && !reservedLabels[name] && !(name[0] >= '0' && name[0] <= '9') && !strings.HasPrefix(name, "__")
+}
+
+// parsePoolLabels parses -pool.labels, pool:name=value,... entries separated
+// by semicolons, and returns the labels for pool; other pools' entries let
+// one value be shared by the exporters of several pools.
+func parsePoolLabels(s, pool string, labeler *imageLabeler) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, pairs, ok := strings.Cut(entry, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("pool.labels: %q is not pool:name=value,...", entry)
+		}
+		for _, pair := range splitList(pairs) {
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok || !validLabelName(k) || slices.Contains(labeler.Names(), k) || !labelNameRe.MatchString(k) {
+				return nil, fmt.Errorf("pool.labels: invalid label %q", pair)
+			}
+			if name == pool {
+				labels[k] = v
+			}
+		}
+	}
+	return labels, nil
+}
+
+// checkLabelNames checks the image label regex group names and the pool
+// labels against the label names of c's series, as the enabled collectors
+// make them: the per-image series carry the group names besides their
+// own, and every series the pool labels.
+func checkLabelNames(c prometheus.Collector, labeler *imageLabeler, poolLabels prometheus.Labels) error {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	var err error
+	for d := range ch {
+		if err != nil {
+			continue
+		}
+		counts := make(map[string]int)
+		for _, name := range descLabelNames(d) {
+			counts[name]++
+		}
+		for _, name := range labeler.Names() {
+			if counts[name] > 1 {
+				err = fmt.Errorf("image label regex: label name %q is used by %s", name, descName(d))
+			}
+		}
+		for name := range poolLabels {
+			if counts[name] > 0 {
+				err = fmt.Errorf("pool.labels: label name %q is used by %s", name, descName(d))
+			}
+		}
+	}
+	return err
+}
+
+// descLabelNames returns the variable label names of d. Desc has no
+// accessor for them; its String form lists them last.
+func descLabelNames(d *prometheus.Desc) []string {
+	s := d.String()
+	i := strings.LastIndex(s, "variableLabels: {")
+	if i < 0 {
+		return nil
+	}
+	s = strings.TrimSuffix(s[i+len("variableLabels: {"):], "}}")
+	names := splitList(s)
+	for i, name := range names {
+		// constrained labels print as c(name)
+		names[i] = strings.TrimSuffix(strings.TrimPrefix(name, "c("), ")")
+	}
+	return names
+}
+
+// descName returns the metric name of d.
+func descName(d *prometheus.Desc) string {
+	s := d.String()
+	if _, rest, ok := strings.Cut(s, `fqName: "`); ok {
+		if name, _, ok := strings.Cut(rest, `"`); ok {
+			return name
+		}
+	}
+	return s
+}
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// imageLabeler turns the named groups of a regular expression matched
+// against the image name into extra labels, e.g.
+// ^vm-(?P<vmid>\d+)-disk-(?P<disk>\d+)$ yields vmid and disk.
+// A nil labeler adds no labels.
+type imageLabeler struct {
+	re    *regexp.Regexp
+	names []string
+	index []int
+}
+
+func newImageLabeler(expr string) (*imageLabeler, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("image label regex: %w", err)
+	}
+	l := &imageLabeler{re: re}
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if !validLabelName(name) {
+			return nil, fmt.Errorf("image label regex: invalid label name %q", name)
+		}
+		l.names = append(l.names, name)
+		l.index = append(l.index, i)
+	}
+	if len(l.names) == 0 {
+		return nil, fmt.Errorf("image label regex: %q has no named groups", expr)
+	}
+	return l, nil
+}
+
+// Names returns the label names in the order Values fills them.
+func (l *imageLabeler) Names() []string {
+	if l == nil {
+		return nil
+	}
+	return l.names
+}
+
+// matches tells whether image matches the regex; a nil labeler matches
+// every image.
+func (l *imageLabeler) matches(image string) bool {
+	if l == nil {
+		return true
+	}
+	if i := strings.LastIndexByte(image, '/'); i >= 0 {
+		image = image[i+1:]
+	}
+	return l.re.MatchString(image)
+}
+
+// Values returns the label values for image; groups that did not
+// participate in the match, or images that don't match at all, are empty.
+// The namespace part of a namespace/image id is not matched.
+func (l *imageLabeler) Values(image string) []string {
+	if l == nil {
+		return nil
+	}
+	if i := strings.LastIndexByte(image, '/'); i >= 0 {
+		image = image[i+1:]
+	}
+	values := make([]string, len(l.names))
+	m := l.re.FindStringSubmatch(image)
+	if m == nil {
+		return values
+	}
+	for i, idx := range l.index {
+		values[i] = m[idx]
+	}
+	return values
+}
+
+// stateLabelMax caps state label values; rbd's own are far shorter.
+const stateLabelMax = 64
+
+var labelsSanitized = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: MetricPrefix + "label_values_sanitized_total",
+	Help: "Label values taken from rbd output that had to be cleaned up or shortened, by label",
+}, []string{"label"})
+
+// sanitizeLabel makes a label value taken from rbd output safe to emit:
+// valid NFC-normalized UTF-8 on one line, whitespace runs collapsed, at
+// most max characters. Changed values are counted under label.
+func sanitizeLabel(label, s string, max int) string {
+	out := strings.Join(strings.FieldsFunc(norm.NFC.String(strings.ToValidUTF8(s, "\uFFFD")), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+	out = truncate(out, max)
+	if out != s {
+		labelsSanitized.WithLabelValues(label).Inc()
+	}
+	return out
+}
+
+// sanitizeStates sanitizes the states in ps, which end up as label values.
+func sanitizeStates(ps *poolStatus) {
+	for i := range ps.Images {
+		img := &ps.Images[i]
+		img.State = sanitizeLabel("state", img.State, stateLabelMax)
+		for j := range img.PeerSites {
+			img.PeerSites[j].State = sanitizeLabel("state", img.PeerSites[j].State, stateLabelMax)
+		}
+	}
+	states := make(map[string]int, len(ps.Summary.States))
+	for state, n := range ps.Summary.States {
+		states[sanitizeLabel("state", state, stateLabelMax)] += n
+	}
+	ps.Summary.States = states
+}
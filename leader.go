@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// leaderElector lets two exporter replicas run for redundancy with only
+// one of them running rbd: the leader is whoever holds an exclusive lock
+// on a shared file, and the standby keeps trying to take it over. The lock
+// goes away with the process, so a crashed leader is replaced within one
+// retry interval. A nil elector is always the leader.
+type leaderElector struct {
+	path   string
+	retry  time.Duration
+	leader atomic.Bool
+	file   *os.File // kept open, and thus locked, while leading
+
+	descLeader *prometheus.Desc
+}
+
+func newLeaderElector(path string, retry time.Duration) (*leaderElector, error) {
+	if path == "" {
+		return nil, nil
+	}
+	e := &leaderElector{
+		path:       path,
+		retry:      retry,
+		descLeader: prometheus.NewDesc(MetricPrefix+"leader", "Whether this replica is the leader running rbd (1) or a standby (0)", nil, nil),
+	}
+	// settle the initial role before anything is collected
+	if err := e.try(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// try attempts to take the lock once.
+func (e *leaderElector) try() error {
+	f, err := os.OpenFile(e.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	ok, err := tryLockFile(f)
+	if err != nil || !ok {
+		f.Close()
+		return err
+	}
+	e.file = f
+	e.leader.Store(true)
+	log.Printf("acquired leader lock %s", e.path)
+	return nil
+}
+
+// run retries taking the lock until it is held or ctx is done.
+func (e *leaderElector) run(ctx context.Context) {
+	if e == nil {
+		return
+	}
+	t := time.NewTicker(e.retry)
+	defer t.Stop()
+	for !e.isLeader() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := e.try(); err != nil {
+			log.Printf("leader lock %s: %v", e.path, err)
+		}
+	}
+}
+
+func (e *leaderElector) isLeader() bool {
+	return e == nil || e.leader.Load()
+}
+
+func (e *leaderElector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.descLeader
+}
+
+func (e *leaderElector) Collect(ch chan<- prometheus.Metric) {
+	v := 0.0
+	if e.isLeader() {
+		v = 1
+	}
+	ch <- prometheus.MustNewConstMetric(e.descLeader, prometheus.GaugeValue, v)
+}
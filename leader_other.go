@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLockFile is not implemented where flock does not exist.
+func tryLockFile(f *os.File) (bool, error) {
+	return false, errors.New("leader election is not supported on this platform")
+}
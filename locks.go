@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lockCollector exposes who holds each image's lock, i.e. which hypervisor
+// currently runs the VM.
+type lockCollector struct {
+	descLockInfo *prometheus.Desc
+	descLocks    *prometheus.Desc
+}
+
+func newLockCollector(labels []string) imageCollector {
+	mp := MetricPrefix
+	return &lockCollector{
+		descLockInfo: prometheus.NewDesc(mp+"image_lock_info", "Image lock holder (always 1)", append(labels[:len(labels):len(labels)], "lock_owner", "lock_owner_address"), nil),
+		descLocks:    prometheus.NewDesc(mp+"image_locks", "Number of locks held on the image", labels, nil),
+	}
+}
+
+type imageLock struct {
+	ID      string `json:"id"`
+	Locker  string `json:"locker"`
+	Address string `json:"address"`
+}
+
+// decodeLocks accepts both the list rbd prints nowadays and the object keyed
+// by lock id of older releases.
+func decodeLocks(raw []byte) ([]imageLock, error) {
+	var list []imageLock
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var byID map[string]imageLock
+	if err := json.Unmarshal(raw, &byID); err != nil {
+		return nil, err
+	}
+	for id, l := range byID {
+		l.ID = id
+		list = append(list, l)
+	}
+	return list, nil
+}
+
+func (l *lockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- l.descLockInfo
+	ch <- l.descLocks
+}
+
+func (l *lockCollector) fetch(ctx context.Context, spec string) (any, error) {
+	raw, err := RunRBD(ctx, "lock", "ls", spec, "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	locks, err := decodeLocks(raw)
+	return locks, decodeFailed(err)
+}
+
+func (l *lockCollector) collect(ch chan<- prometheus.Metric, labels []string, data any) {
+	locks := data.([]imageLock)
+	ch <- prometheus.MustNewConstMetric(l.descLocks, prometheus.GaugeValue, float64(len(locks)), labels...)
+	for _, lk := range locks {
+		ch <- prometheus.MustNewConstMetric(l.descLockInfo, prometheus.GaugeValue, 1, append(labels[:len(labels):len(labels)], lk.Locker, lk.Address)...)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// log levels; debug adds the rbd command lines, their stderr and other
+// details to the log
+const (
+	logLevelInfo  = "info"
+	logLevelDebug = "debug"
+)
+
+func logLevel() string {
+	if Debug.Load() {
+		return logLevelDebug
+	}
+	return logLevelInfo
+}
+
+// setLogLevel switches the log level, logging the change.
+func setLogLevel(level string) error {
+	switch level {
+	case logLevelInfo, logLevelDebug:
+	default:
+		return fmt.Errorf("unknown log level %q (want %s or %s)", level, logLevelInfo, logLevelDebug)
+	}
+	if old := logLevel(); old != level {
+		Debug.Store(level == logLevelDebug)
+		log.Printf("log level changed from %s to %s", old, level)
+	}
+	return nil
+}
+
+// toggleLogLevel switches between info and debug.
+func toggleLogLevel() {
+	level := logLevelDebug
+	if Debug.Load() {
+		level = logLevelInfo
+	}
+	setLogLevel(level)
+}
+
+// logLevelHandler serves /-/loglevel: GET returns the current level, PUT
+// sets the one in the request body.
+func logLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := setLogLevel(strings.ToLower(strings.TrimSpace(string(body)))); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, logLevel())
+	})
+}
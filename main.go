@@ -4,83 +4,901 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"math"
 	"net/http"
-    "os/exec"
+	"os"
+	"os/exec"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
-    "github.com/prometheus/client_golang/prometheus"
-    "github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
 	Version      = "0.1.19" // overridden by build flags
 	MetricPrefix = "ceph_vm_"
-	Debug        = false
+	Debug        atomic.Bool // switched at runtime by SIGUSR2 and /-/loglevel
+
+	// rbdSlots bounds the number of concurrent rbd processes; nil means unlimited.
+	rbdSlots chan struct{}
+	// rbdMaxOutput caps the stdout read from an rbd process; 0 means unlimited.
+	rbdMaxOutput int64
 )
 
-// CLI flags
-func parseFlags() (cfg struct {
+// config holds the command-line flags, shared by all subcommands.
+type config struct {
 	pool      string
 	ipAddress string
 	port      int
 	showVer   bool
 	debug     bool
-}) {
+	labelRe   string
+	vmAgg     string
+	aggOnly   bool
+	poolLbls  string
+	siteLabel bool
+	blHosts   string
+	metaKeys  string
+	expPeers  int
+	peerAttrs bool
+	siteRole  string
+	recentSn  int
+	images    string
+	buckets   string
+	stateFile string
+	dumpFile  string
+	rbdMax    int
+	rbdMaxOut int64
+	warmup    time.Duration
+	minIntv   time.Duration
+	tmOffset  time.Duration
+	accessLog string
+	maxReqs   int
+	compress  string
+	logLvlAPI bool
+	metricsAt string
+	colPaths  string
+	shardIdx  int
+	shardTot  int
+	lockFile  string
+	lockRetry time.Duration
+	descLen   int
+	legacyMiB bool
+	noPrefl   bool
+	backend   string
+	mgr       struct {
+		url, token, tokenFile, caFile string
+	}
+	rbdEnv  string
+	inhEnv  string
+	keyring string
+	keyFile string
+	oidc    struct {
+		issuer, jwksURL, audience string
+	}
+	nsList    string
+	imageCols map[string]*bool
+	poolCols  map[string]*bool
+	grpcAddr  string
+	traceURL  string
+	webhooks  string
+	debounce  time.Duration
+	chat      struct {
+		slackURL, tmpl                      string
+		tgAPI, tgToken, tgTokenFile, tgChat string
+		rateLimit                           int
+	}
+	am struct {
+		urls               string
+		interval, errorFor time.Duration
+	}
+	maxLag    time.Duration
+	minSpeed  float64
+	forbidden string
+	influx    struct {
+		url, org, bucket, token, tokenFile string
+		interval                           time.Duration
+	}
+	graphite struct {
+		address, prefix string
+		interval        time.Duration
+	}
+	statsd struct {
+		address, prefix string
+		tags            bool
+		interval        time.Duration
+	}
+}
+
+// parseFlags parses the flags in args, the arguments after the subcommand.
+func parseFlags(args []string) (cfg config) {
 	flag.StringVar(&cfg.pool, "pool", "ceph-pool1", "Ceph pool to scan for VM images")
 	flag.StringVar(&cfg.ipAddress, "ipaddress", "", "IP address to listen on")
 	flag.IntVar(&cfg.port, "port", 9125, "TCP port to listen on")
-	flag.BoolVar(&cfg.showVer, "version", false, "Print version and exit")
-	flag.BoolVar(&cfg.debug, "debug", false, "Enable debug logging")
-	flag.Parse()
+	flag.BoolVar(&cfg.showVer, "version", false, "Print version and exit (deprecated, use the version command)")
+	flag.BoolVar(&cfg.debug, "debug", false, "Enable debug logging (toggled at runtime by SIGUSR2)")
+	flag.BoolVar(&cfg.logLvlAPI, "web.enable-loglevel", false, "Serve /-/loglevel, which sets the log level (info or debug) on PUT")
+	flag.StringVar(&cfg.labelRe, "image.label-regex", "", "Regex matched against image names; named groups become labels (e.g. ^vm-(?P<vmid>\\d+)-disk-(?P<disk>\\d+)$)")
+	flag.StringVar(&cfg.vmAgg, "vm.aggregate", vmAggregateOff, "Per-VM aggregated series keyed by the vmid label: off, also (in addition to per-image series) or only")
+	flag.StringVar(&cfg.poolLbls, "pool.labels", "", "Static labels added to every series of a pool, as pool:name=value,... entries separated by semicolons (e.g. ceph-pool1:tenant=finance)")
+	flag.StringVar(&cfg.siteRole, "site-role", siteRolePrimary, "Side of the mirroring this cluster is: primary (images replayed by the peer, judged by the peer's state) or secondary (images replayed here, judged by their local state)")
+	flag.BoolVar(&cfg.siteLabel, "site.label", false, "Add the local site name, read from the cluster at startup, as a site label to every series of the pool")
+	flag.IntVar(&cfg.recentSn, "collector.snapshots.recent", 0, "Export size, creation time and protection of each image's N newest snapshots with the snapshots collector (0 = off)")
+	flag.StringVar(&cfg.metaKeys, "collector.meta.keys", "", "Comma-separated image-meta keys (e.g. owner,project) whose values the meta collector exports as labels")
+	flag.IntVar(&cfg.expPeers, "collector.poolinfo.expected-peers", 0, "Number of peers the pool should have, checked by the poolinfo collector (0 = no check)")
+	flag.BoolVar(&cfg.peerAttrs, "collector.poolinfo.peer-attributes", false, "Have the poolinfo collector read the peers' monitor hosts and whether a key is stored (rbd mirror pool info --all, needs access to the peer secrets)")
+	flag.StringVar(&mirrorConfigWho, "collector.mirrorconfig.who", mirrorConfigWho, "Config section the mirrorconfig collector reads the rbd-mirror settings of, e.g. client.rbd-mirror.site-a for one daemon")
+	flag.StringVar(&cfg.blHosts, "collector.blocklist.peer-hosts", "", "Comma-separated hosts of the peer cluster's rbd-mirror daemons, checked by the blocklist collector besides the local ones")
+	flag.BoolVar(&cfg.aggOnly, "aggregate-only", false, "Emit pool and namespace level aggregates instead of any per-image or per-VM series")
+	flag.StringVar(&cfg.buckets, "snapshot.sync-buckets", formatBuckets(defaultSyncBuckets), "Comma-separated histogram buckets for snapshot sync durations (s)")
+	flag.IntVar(&journalObjectSize, "journal.object-size", journalObjectSize, "Size of the images' journal objects (2^rbd_journal_order bytes), for estimating the journal lag in bytes")
+	flag.StringVar(&cfg.stateFile, "state.file", "", "JSON file persisting derived counters across restarts (disabled if empty)")
+	flag.StringVar(&cfg.dumpFile, "dump.file", "", "File to write the SIGUSR1 diagnostic state dump to (logged if empty)")
+	flag.StringVar(&cfg.rbdEnv, "rbd.env", "", "Comma-separated KEY=VALUE environment variables for rbd, e.g. CEPH_ARGS=--id mirror-monitor")
+	flag.StringVar(&cfg.inhEnv, "rbd.inherit-env", defaultInheritedEnv, "Comma-separated environment variables rbd inherits from the exporter; * passes the whole environment")
+	flag.StringVar(&cfg.keyring, "rbd.keyring", "", "Keyring file passed to rbd with --keyring; rbd re-reads it on every run")
+	flag.StringVar(&cfg.keyFile, "rbd.keyfile", "", "File with the bare cephx key, passed to rbd with --keyfile; rbd re-reads it on every run")
+	flag.IntVar(&cfg.rbdMax, "rbd.max-concurrent", 4, "Maximum number of rbd processes running at once (0 = unlimited)")
+	flag.Int64Var(&cfg.rbdMaxOut, "rbd.max-output", 256<<20, "Maximum stdout of an rbd process in bytes; longer outputs fail the run (0 = unlimited)")
+	flag.DurationVar(&cfg.warmup, "warmup.timeout", 15*time.Second, "Time allowed for an initial collection before the HTTP server starts (0 = skip)")
+	flag.DurationVar(&cfg.minIntv, "collect.min-interval", 0, "Minimum time between rbd collections; scrapes in between are served from the previous result")
+	flag.StringVar(&cfg.metricsAt, "web.telemetry-path", "/metrics", "Path under which to expose metrics")
+	flag.DurationVar(&cfg.tmOffset, "web.timeout-offset", 500*time.Millisecond, "Offset subtracted from the scraper's X-Prometheus-Scrape-Timeout-Seconds to bound collections")
+	flag.StringVar(&cfg.compress, "web.compression", compressionOn, "Gzip metrics responses for clients accepting it: on, off, or the minimum response size in bytes to compress")
+	flag.IntVar(&cfg.maxReqs, "web.max-requests", 10, "Maximum number of concurrent scrapes per metrics path; more get a 503 (0 = unlimited)")
+	flag.StringVar(&cfg.accessLog, "web.access-log", accessLogOff, "HTTP requests to log: off, errors (status 400 and above, e.g. rejected tokens) or all")
+	flag.StringVar(&cfg.colPaths, "web.collector-paths", "", "Comma-separated collector=path pairs (e.g. usage=/metrics/du) serving optional collectors on their own path, fetched only when it is scraped; implies -collector.<name>")
+	flag.IntVar(&cfg.shardIdx, "shard.index", 0, "Index of this replica when splitting images across -shard.total exporters")
+	flag.IntVar(&cfg.shardTot, "shard.total", 1, "Number of exporter replicas sharing the pool's images; pool-wide series come from shard 0")
+	flag.StringVar(&cfg.lockFile, "leader.lock-file", "", "File on storage shared by a replica pair; only the replica holding its lock runs rbd (disabled if empty)")
+	flag.DurationVar(&cfg.lockRetry, "leader.retry-interval", 5*time.Second, "How often a standby replica tries to take over the leader lock")
+	flag.IntVar(&cfg.descLen, "image.description-info-length", 0, "Export peer descriptions cut to this many characters as image_description_info (0 = off)")
+	flag.BoolVar(&cfg.legacyMiB, "legacy-mib-metrics", true, "Also emit the deprecated MiB based series alongside the byte based ones")
+	flag.StringVar(&cfg.oidc.issuer, "web.oidc-issuer", "", "OIDC issuer URL; when set, metrics, API and gRPC requests need a bearer token it issued (/health/replication, /version and / stay open)")
+	flag.StringVar(&cfg.oidc.jwksURL, "web.oidc-jwks-url", "", "JWKS URL with the token signing keys (discovered from the issuer if empty)")
+	flag.StringVar(&cfg.oidc.audience, "web.oidc-audience", "", "Audience tokens must be issued for")
+	flag.BoolVar(&cfg.noPrefl, "skip-preflight", false, "Start even if rbd cannot be run or the pool is not accessible")
+	flag.StringVar(&cfg.backend, "backend", backendRBD, "Source of the mirroring status: rbd (the rbd CLI) or mgr (the Ceph mgr dashboard REST API; no optional collectors or namespaces)")
+	flag.StringVar(&cfg.mgr.url, "mgr.url", "", "Ceph mgr dashboard URL for -backend mgr, e.g. https://mgr:8443")
+	flag.StringVar(&cfg.mgr.token, "mgr.token", "", "Ceph mgr dashboard API token")
+	flag.StringVar(&cfg.mgr.tokenFile, "mgr.token-file", "", "File with the Ceph mgr dashboard API token, re-read when it changes")
+	flag.StringVar(&cfg.mgr.caFile, "mgr.ca-file", "", "PEM file with the CA certificates to verify the mgr dashboard with (system roots if empty)")
+	flag.StringVar(&cfg.images, "images", "", "Comma-separated pool/[namespace/]image specs to monitor instead of every image of the pool, read with rbd mirror image status one by one")
+	flag.StringVar(&cfg.nsList, "namespaces", "", "Comma-separated RBD namespaces to scan in addition to the pool's default namespace")
+	cfg.imageCols = make(map[string]*bool)
+	for _, ic := range imageCollectors {
+		cfg.imageCols[ic.name] = flag.Bool("collector."+ic.name, false, "Enable the per-image "+ic.help+" collector")
+	}
+	cfg.poolCols = make(map[string]*bool)
+	for _, pc := range poolCollectors {
+		cfg.poolCols[pc.name] = flag.Bool("collector."+pc.name, false, "Enable the pool "+pc.help+" collector")
+	}
+	flag.StringVar(&cfg.traceURL, "tracing.endpoint", "", "OTLP/HTTP endpoint receiving a trace per scrape with a span per rbd command, e.g. http://tempo:4318 (disabled if empty)")
+	flag.StringVar(&cfg.grpcAddr, "grpc.listen-address", "", "Address for the gRPC status service, e.g. :9126 (disabled if empty)")
+	flag.StringVar(&cfg.webhooks, "notify.webhook-urls", "", "Comma-separated URLs to POST replication state transitions to")
+	flag.DurationVar(&cfg.debounce, "notify.debounce", time.Minute, "How long a state transition must persist before it is notified")
+	flag.StringVar(&cfg.chat.slackURL, "notify.slack-webhook-url", "", "Slack incoming webhook URL to post replication state transitions to")
+	flag.StringVar(&cfg.chat.tgToken, "notify.telegram-token", "", "Telegram bot token to send replication state transitions with, to -notify.telegram-chat-id")
+	flag.StringVar(&cfg.chat.tgTokenFile, "notify.telegram-token-file", "", "File with the Telegram bot token, re-read when it changes")
+	flag.StringVar(&cfg.chat.tgChat, "notify.telegram-chat-id", "", "Telegram chat to send notifications to")
+	flag.StringVar(&cfg.chat.tgAPI, "notify.telegram-api-url", "https://api.telegram.org", "Telegram Bot API URL")
+	flag.StringVar(&cfg.chat.tmpl, "notify.template", defaultChatTemplate, "Go template of the Slack and Telegram messages, executed with the webhook notification fields (.Event, .Pool, .Image, .OldState, .NewState, .Since)")
+	flag.IntVar(&cfg.chat.rateLimit, "notify.rate-limit", 10, "Most Slack or Telegram messages to send per minute, further ones are dropped (0 = unlimited)")
+	flag.StringVar(&cfg.am.urls, "alertmanager.urls", "", "Comma-separated Alertmanager URLs to send split-brain and prolonged error alerts to directly, e.g. http://alertmanager:9093 (disabled if empty)")
+	flag.DurationVar(&cfg.am.interval, "alertmanager.interval", time.Minute, "How often to check images for Alertmanager alerts and re-send the active ones")
+	flag.DurationVar(&cfg.am.errorFor, "alertmanager.error-for", 10*time.Minute, "How long an image must be in an error state before it is alerted to Alertmanager")
+	flag.DurationVar(&cfg.maxLag, "health.max-lag", 0, "Fail /health/replication when an image lags its primary snapshot by more than this (0 = off)")
+	flag.Float64Var(&cfg.minSpeed, "health.min-speed", 0, "Fail /health/replication when a snapshot sync was slower than this many MiB/s (0 = off)")
+	flag.StringVar(&cfg.forbidden, "health.forbidden-states", "", "Comma-separated replication states (substrings, e.g. error) that fail /health/replication; the peers' states on the primary site, the images' own on the secondary (-site-role)")
+	flag.StringVar(&cfg.influx.url, "influx.url", "", "InfluxDB v2 URL to write metrics to, e.g. http://influx:8086 (disabled if empty)")
+	flag.StringVar(&cfg.influx.org, "influx.org", "", "InfluxDB organization")
+	flag.StringVar(&cfg.influx.bucket, "influx.bucket", "", "InfluxDB bucket")
+	flag.StringVar(&cfg.influx.token, "influx.token", "", "InfluxDB API token")
+	flag.StringVar(&cfg.influx.tokenFile, "influx.token-file", "", "File with the InfluxDB API token, re-read when it changes")
+	flag.DurationVar(&cfg.influx.interval, "influx.interval", time.Minute, "Interval between InfluxDB writes")
+	flag.StringVar(&cfg.graphite.address, "graphite.address", "", "Graphite plaintext host:port to send metrics to (disabled if empty)")
+	flag.StringVar(&cfg.graphite.prefix, "graphite.prefix", "ceph", "Prefix for Graphite metric paths")
+	flag.DurationVar(&cfg.graphite.interval, "graphite.interval", time.Minute, "Interval between Graphite sends")
+	flag.StringVar(&cfg.statsd.address, "statsd.address", "", "StatsD host:port (UDP) to send metrics to (disabled if empty)")
+	flag.StringVar(&cfg.statsd.prefix, "statsd.prefix", "", "Prefix for StatsD metric names")
+	flag.BoolVar(&cfg.statsd.tags, "statsd.tags", true, "Send labels as DogStatsD tags instead of folding them into metric names")
+	flag.DurationVar(&cfg.statsd.interval, "statsd.interval", time.Minute, "Interval between StatsD sends")
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
 	return
 }
 
+func enabledCollectors(flags map[string]*bool) map[string]bool {
+	enabled := make(map[string]bool)
+	for name, on := range flags {
+		enabled[name] = *on
+	}
+	return enabled
+}
+
 func main() {
-	cfg := parseFlags()
+	name, args := "serve", os.Args[1:]
+	// without a subcommand the exporter serves, as it always has
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd := lookupCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	cfg := parseFlags(args)
 	if cfg.showVer {
-		fmt.Println(Version)
-		return
+		cmd = lookupCommand("version")
+	}
+	if err := cmd.run(&cfg); err != nil {
+		log.Fatalf("%s: %v", cmd.name, err)
+	}
+}
+
+// configureRBD applies the flags about running rbd and returns the
+// credential files to watch.
+func configureRBD(cfg *config) (credFiles []*credentialFile) {
+	Debug.Store(cfg.debug)
+	LegacyMiB = cfg.legacyMiB
+	if cfg.rbdMax > 0 {
+		rbdSlots = make(chan struct{}, cfg.rbdMax)
+	}
+	rbdMaxOutput = cfg.rbdMaxOut
+	if cfg.inhEnv != "*" || cfg.rbdEnv != "" {
+		inherit := splitList(cfg.inhEnv)
+		if cfg.inhEnv == "*" {
+			inherit = nil
+			for _, kv := range os.Environ() {
+				k, _, _ := strings.Cut(kv, "=")
+				inherit = append(inherit, k)
+			}
+		}
+		env, err := buildRBDEnv(inherit, splitList(cfg.rbdEnv))
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		rbdEnv = env
+	}
+	for _, kf := range []struct{ flag, opt, path string }{
+		{"rbd.keyring", "--keyring", cfg.keyring},
+		{"rbd.keyfile", "--keyfile", cfg.keyFile},
+	} {
+		if kf.path == "" {
+			continue
+		}
+		f, err := newCredentialFile(kf.flag, kf.path)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		credFiles = append(credFiles, f)
+		rbdAuthArgs = append(rbdAuthArgs, kf.opt, kf.path)
+	}
+	return credFiles
+}
+
+// exporter is the collector built from the flags, with what the
+// subcommands need around it.
+type exporter struct {
+	collector *mirrorCollector
+	// the collector's own registry, holding the detached collectors too
+	registry   *prometheus.Registry
+	poolReg    prometheus.Registerer
+	poolLabels prometheus.Labels
+	detached   map[string][]string // path -> collectors
+	events     *stateBroker
+	health     *healthChecker
+	mgr        *mgrClient
+	credFiles  []*credentialFile
+}
+
+// newExporter validates the flags and builds the collector. Only the
+// daemon, which owns them, restores the state file and takes part in leader
+// election.
+func newExporter(cfg *config, daemon bool) *exporter {
+	x := &exporter{credFiles: configureRBD(cfg)}
+	labeler, err := newImageLabeler(cfg.labelRe)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := checkAccessLog(cfg.accessLog); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := checkVMAggregate(cfg.vmAgg, labeler); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := checkSiteRole(cfg.siteRole); err != nil {
+		log.Fatalf("%v", err)
+	}
+	blocklistPeerHosts = splitList(cfg.blHosts)
+	expectedPeers = cfg.expPeers
+	peerAttributes = cfg.peerAttrs
+	if imageMetaKeys, imageMetaLabels, err = parseMetaKeys(cfg.metaKeys, labeler); err != nil {
+		log.Fatalf("%v", err)
 	}
-	Debug = cfg.debug
-	prometheus.MustRegister(NewCollector(cfg.pool))
-	http.Handle("/metrics", promhttp.Handler())
+	if x.poolLabels, err = parsePoolLabels(cfg.poolLbls, cfg.pool, labeler); err != nil {
+		log.Fatalf("%v", err)
+	}
+	buckets, err := parseBuckets(cfg.buckets)
+	if err != nil {
+		log.Fatalf("snapshot.sync-buckets: %v", err)
+	}
+	tracker := newSyncTracker(buckets, labeler)
+	if daemon && cfg.stateFile != "" {
+		if err := tracker.load(cfg.stateFile); err != nil {
+			log.Fatalf("state.file: %v", err)
+		}
+	}
+	shard, err := newShard(cfg.shardIdx, cfg.shardTot, labeler)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	var leader *leaderElector
+	if daemon {
+		if leader, err = newLeaderElector(cfg.lockFile, cfg.lockRetry); err != nil {
+			log.Fatalf("leader.lock-file: %v", err)
+		}
+		if leader != nil {
+			prometheus.MustRegister(leader)
+			go leader.run(context.Background())
+		}
+	}
+	colPaths, err := parseCollectorPaths(cfg.colPaths)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	imageCols, poolCols := enabledCollectors(cfg.imageCols), enabledCollectors(cfg.poolCols)
+	if _, detached := colPaths["meta"]; (imageCols["meta"] || detached) && len(imageMetaKeys) == 0 {
+		log.Fatalf("collector.meta needs -collector.meta.keys")
+	}
+	if _, detached := colPaths["snapshots"]; cfg.recentSn > 0 && !imageCols["snapshots"] && !detached {
+		log.Fatalf("collector.snapshots.recent needs -collector.snapshots")
+	}
+	recentSnapshots = cfg.recentSn
+	if cfg.am.urls != "" && cfg.am.interval <= 0 {
+		log.Fatalf("alertmanager.interval must be positive")
+	}
+	x.detached = make(map[string][]string)
+	for name, path := range colPaths {
+		delete(imageCols, name)
+		delete(poolCols, name)
+		x.detached[path] = append(x.detached[path], name)
+	}
+	if cfg.aggOnly {
+		if cfg.vmAgg != vmAggregateOff {
+			log.Fatalf("aggregate-only excludes -vm.aggregate")
+		}
+		for name, on := range enabledCollectors(cfg.imageCols) {
+			if _, detached := colPaths[name]; on || detached {
+				log.Fatalf("aggregate-only excludes the per-image collector %s", name)
+			}
+		}
+	}
+	source, site := fetchPoolStatus, siteLookup(fetchSiteName)
+	switch cfg.backend {
+	case backendRBD:
+		if cfg.images != "" {
+			images, err := parseImageList(cfg.images, cfg.pool, splitList(cfg.nsList))
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			source = imageListSource(images)
+			// their view of the pool would be cut down to the listed images
+			poolCols := enabledCollectors(cfg.poolCols)
+			for _, name := range []string{"coverage", "orphans", "schedules"} {
+				if _, detached := colPaths[name]; poolCols[name] || detached {
+					log.Fatalf("images: collector %s needs the whole pool", name)
+				}
+			}
+		}
+	case backendMgr:
+		if cfg.images != "" {
+			log.Fatalf("backend mgr: -images is not supported")
+		}
+		if len(splitList(cfg.nsList)) > 0 {
+			log.Fatalf("backend mgr: -namespaces is not supported")
+		}
+		for name, on := range enabledCollectors(cfg.imageCols) {
+			if _, detached := colPaths[name]; on || detached {
+				log.Fatalf("backend mgr: collector %s needs the rbd backend", name)
+			}
+		}
+		for name, on := range enabledCollectors(cfg.poolCols) {
+			if _, detached := colPaths[name]; on || detached {
+				log.Fatalf("backend mgr: collector %s needs the rbd backend", name)
+			}
+		}
+		token := func() string { return cfg.mgr.token }
+		if cfg.mgr.tokenFile != "" {
+			if cfg.mgr.token != "" {
+				log.Fatalf("mgr.token and mgr.token-file are mutually exclusive")
+			}
+			f, err := newCredentialFile("mgr.token-file", cfg.mgr.tokenFile)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			x.credFiles = append(x.credFiles, f)
+			token = f.get
+		}
+		if x.mgr, err = newMgrClient(cfg.mgr.url, cfg.mgr.caFile, token); err != nil {
+			log.Fatalf("%v", err)
+		}
+		source, site = x.mgr.poolStatus, x.mgr.siteName
+	default:
+		log.Fatalf("backend: unknown backend %q", cfg.backend)
+	}
+	if cfg.siteLabel {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		name, err := site(ctx, cfg.pool)
+		cancel()
+		switch {
+		case err != nil:
+			log.Fatalf("site.label: %v", err)
+		case name == "":
+			log.Fatalf("site.label: no site name set for the mirroring of pool %s", cfg.pool)
+		case x.poolLabels["site"] != "":
+			log.Fatalf("site.label: -pool.labels sets site already")
+		}
+		if x.poolLabels == nil {
+			x.poolLabels = make(prometheus.Labels)
+		}
+		x.poolLabels["site"] = name
+	}
+	x.events = newStateBroker()
+	x.health = newHealthChecker(healthThresholds{
+		maxLag:          cfg.maxLag,
+		minSpeedMiB:     cfg.minSpeed,
+		forbiddenStates: splitList(cfg.forbidden),
+	}, cfg.siteRole)
+	x.collector = NewCollector(collectorOptions{
+		pool:        cfg.pool,
+		labeler:     labeler,
+		source:      source,
+		site:        site,
+		vmAggregate: cfg.vmAgg,
+		aggregate:   cfg.aggOnly,
+		tracker:     tracker,
+		shard:       shard,
+		leader:      leader,
+		descLen:     cfg.descLen,
+		siteRole:    cfg.siteRole,
+		minInterval: cfg.minIntv,
+		namespaces:  splitList(cfg.nsList),
+		imageCols:   imageCols,
+		poolCols:    poolCols,
+		events:      x.events,
+		health:      x.health,
+	})
+	// the collector has its own registry so that scrapes can bind it to
+	// the scrape's timeout; both carry the pool's static labels
+	if err := checkLabelNames(x.collector, labeler, x.poolLabels); err != nil {
+		log.Fatalf("%v", err)
+	}
+	x.registry = prometheus.NewRegistry()
+	x.poolReg = prometheus.WrapRegistererWith(x.poolLabels, x.registry)
+	if err := x.poolReg.Register(x.collector); err != nil {
+		log.Fatalf("register collector: %v", err)
+	}
+	return x
+}
+
+// preflight checks access to the pool through the configured backend.
+func (x *exporter) preflight(cfg *config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if x.mgr != nil {
+		_, err := x.mgr.poolStatus(ctx, cfg.pool, "")
+		return err
+	}
+	return preflight(ctx, cfg.pool, splitList(cfg.nsList))
+}
+
+// serve runs the exporter as a daemon.
+func serve(cfg *config) error {
+	if tracing = newTracer(cfg.traceURL); tracing != nil {
+		go tracing.run(context.Background())
+	}
+	startTime := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: MetricPrefix + "exporter_start_time_seconds",
+		Help: "Start time of the exporter process since unix epoch (s)",
+	})
+	startTime.SetToCurrentTime()
+	prometheus.MustRegister(startTime)
+	prometheus.MustRegister(rbdInvocations, rbdWarnings, rbdOutputNoise, rbdOutputTruncated, rbdKilled, rbdErrors, labelsSanitized, collectorPanics)
+	prometheus.MustRegister(newConfigMetrics("flags", configHash()))
+	x := newExporter(cfg, true)
+	collector, credFiles := x.collector, x.credFiles
+	auth, err := newOIDCVerifier(cfg.oidc.issuer, cfg.oidc.jwksURL, cfg.oidc.audience)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if !cfg.noPrefl {
+		if err := x.preflight(cfg); err != nil {
+			log.Fatalf("preflight: %v (use -skip-preflight to start anyway)", err)
+		}
+	}
+	gatherer := prometheus.Gatherers{prometheus.DefaultGatherer, x.registry}
+	detachedCols := make(map[string]*detachedCollector, len(x.detached))
+	for path, names := range x.detached {
+		if path == cfg.metricsAt {
+			log.Fatalf("web.collector-paths: %s is the main metrics path", path)
+		}
+		d := collector.detach(names)
+		if err := checkLabelNames(d, collector.labeler, x.poolLabels); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := x.poolReg.Register(d); err != nil {
+			log.Fatalf("web.collector-paths: %v", err)
+		}
+		detachedCols[path] = d
+	}
+	notifyDump(func() { writeDump(cfg.dumpFile, collector) })
+	notifyLogToggle()
+	if cfg.warmup > 0 && collector.leader.isLeader() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.warmup)
+		start := time.Now()
+		if err := collector.warmUp(ctx); err != nil {
+			log.Printf("warm-up collection failed: %v", err)
+		} else {
+			log.Printf("warm-up collection done in %s", time.Since(start).Round(time.Millisecond))
+		}
+		cancel()
+	}
+	if sinks := notifySinks(cfg, &credFiles); len(sinks) > 0 {
+		go newNotifier(sinks, cfg.debounce).run(context.Background(), x.events)
+	}
+	if urls := splitList(cfg.am.urls); len(urls) > 0 {
+		go newAMClient(urls, cfg.am.interval, cfg.am.errorFor).run(context.Background(), collector)
+	}
+	if cfg.influx.url != "" {
+		token := func() string { return cfg.influx.token }
+		if cfg.influx.tokenFile != "" {
+			if cfg.influx.token != "" {
+				log.Fatalf("influx.token and influx.token-file are mutually exclusive")
+			}
+			f, err := newCredentialFile("influx.token-file", cfg.influx.tokenFile)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			credFiles = append(credFiles, f)
+			token = f.get
+		}
+		out, err := newInfluxOutput(cfg.influx.url, cfg.influx.org, cfg.influx.bucket, token)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		go pushLoop(context.Background(), "influx", cfg.influx.interval, gatherer, out.push)
+	}
+	if len(credFiles) > 0 {
+		prometheus.MustRegister(newCredentialMetrics(credFiles))
+		for _, f := range credFiles {
+			go f.watch(context.Background())
+		}
+	}
+	if cfg.graphite.address != "" {
+		out := newGraphiteOutput(cfg.graphite.address, cfg.graphite.prefix)
+		go pushLoop(context.Background(), "graphite", cfg.graphite.interval, gatherer, out.push)
+	}
+	if cfg.statsd.address != "" {
+		out := newStatsdOutput(cfg.statsd.address, cfg.statsd.prefix, cfg.statsd.tags)
+		go pushLoop(context.Background(), "statsd", cfg.statsd.interval, gatherer, out.push)
+	}
+	if cfg.grpcAddr != "" {
+		if err := serveGRPC(cfg.grpcAddr, collector, x.events, auth.serverOptions()...); err != nil {
+			log.Fatalf("%v", err)
+		}
+		log.Printf("Serving gRPC status on %s", cfg.grpcAddr)
+	}
+	compress, err := parseCompression(cfg.compress)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if !strings.HasPrefix(cfg.metricsAt, "/") {
+		log.Fatalf("web.telemetry-path: %q must start with /", cfg.metricsAt)
+	}
+	// health, version and the landing page stay open to load balancers
+	// and uptime checks; metrics and the APIs need a token
+	http.Handle(cfg.metricsAt, auth.wrap(metricsHandler(prometheus.DefaultGatherer, collector, x.poolLabels, cfg.tmOffset, cfg.maxReqs, compress)))
+	metricsPaths := []string{cfg.metricsAt}
+	for path, d := range detachedCols {
+		http.Handle(path, auth.wrap(metricsHandler(prometheus.Gatherers{}, d, x.poolLabels, cfg.tmOffset, cfg.maxReqs, compress)))
+		metricsPaths = append(metricsPaths, path)
+	}
+	slices.Sort(metricsPaths[1:])
+	http.Handle("/health/replication", x.health)
+	http.Handle("/version", versionHandler())
+	http.Handle("/sd", auth.wrap(httpSDHandler(cfg.pool, x.poolLabels, metricsPaths, x.detached)))
+	if cfg.logLvlAPI {
+		http.Handle("/-/loglevel", auth.wrap(logLevelHandler()))
+	}
+	http.Handle("/", landingHandler(metricsPaths))
 	addr := fmt.Sprintf("%s:%d", cfg.ipAddress, cfg.port)
 	log.Printf("Starting ceph-exporter on http://%s", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatalf("HTTP server failed: %v", err)
+	if err := http.ListenAndServe(addr, accessLog(cfg.accessLog, http.DefaultServeMux)); err != nil {
+		return fmt.Errorf("HTTP server failed: %w", err)
 	}
+	return nil
 }
 
 // RBD executor
 func RunRBD(ctx context.Context, args ...string) ([]byte, error) {
-	if Debug {
-		log.Printf("[DEBUG] run: rbd %s", strings.Join(args, " "))
+	return runCephTool(ctx, "rbd", args)
+}
+
+// RunCeph runs the ceph CLI like RunRBD, sharing its process slots,
+// environment and credentials.
+func RunCeph(ctx context.Context, args ...string) ([]byte, error) {
+	return runCephTool(ctx, "ceph", args)
+}
+
+func runCephTool(ctx context.Context, tool string, args []string) ([]byte, error) {
+	var out []byte
+	err := streamCephTool(ctx, tool, args, func(r io.Reader) (err error) {
+		out, err = io.ReadAll(r)
+		return err
+	})
+	if err == nil {
+		out = cleanJSON(args, out)
 	}
-	cmd := exec.CommandContext(ctx, "rbd", args...)
+	return out, err
+}
+
+// streamCephTool runs tool with args, passing its stdout to consume as it
+// is printed. Beyond -rbd.max-output bytes the output is cut off and the
+// run fails.
+func streamCephTool(ctx context.Context, tool string, args []string, consume func(stdout io.Reader) error) error {
+	if rbdSlots != nil {
+		select {
+		case rbdSlots <- struct{}{}:
+			defer func() { <-rbdSlots }()
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for rbd slot: %w", ctx.Err())
+		}
+	}
+	if Debug.Load() {
+		log.Printf("[DEBUG] run: %s %s", tool, strings.Join(args, " "))
+	}
+	if tool == "rbd" {
+		countRBD(ctx, args)
+	}
+	ctx, sp := startSpan(ctx, tool+" "+rbdSubcommand(args), spanKindClient)
+	sp.set(tool+".args", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, tool, append(args[:len(args):len(args)], rbdAuthArgs...)...)
+	cmd.Env = rbdEnv
+	killOnCancel(cmd, func() { rbdKilled.WithLabelValues(rbdSubcommand(args)).Inc() })
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-	out, err := cmd.Output()
-	if err != nil && Debug {
-		log.Printf("[DEBUG] rbd error: %v; stderr: %s", err, strings.TrimSpace(stderr.String()))
+	limit := rbdMaxOutput
+	if limit <= 0 {
+		limit = math.MaxInt64 - 1
 	}
-	return out, err
+	var consumeErr error
+	truncated := false
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err == nil {
+		lr := &io.LimitedReader{R: stdout, N: limit + 1}
+		consumeErr = consume(lr)
+		// whatever consume left, so that the process can exit
+		io.Copy(io.Discard, lr)
+		truncated = lr.N == 0
+		if truncated {
+			// nothing reads the rest; closing the pipe ends the process
+			// rather than leaving it blocked on a full pipe until ctx expires
+			stdout.Close()
+		}
+		err = cmd.Wait()
+	}
+	// rbd may warn about real problems and still exit 0
+	countWarnings(args, stderr.String())
+	if err != nil && Debug.Load() {
+		log.Printf("[DEBUG] %s error: %v; stderr: %s", tool, err, strings.TrimSpace(stderr.String()))
+	}
+	if msg := lastLine(stderr.String()); err != nil && msg != "" {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	switch {
+	case truncated:
+		// the process was cut off, its exit status says nothing
+		rbdOutputTruncated.WithLabelValues(rbdSubcommand(args)).Inc()
+		err = fmt.Errorf("%s %s: %w at %d bytes (-rbd.max-output)", tool, rbdSubcommand(args), errOutputTruncated, limit)
+	case err == nil:
+		err = consumeErr
+	}
+	if err != nil {
+		rbdErrors.WithLabelValues(rbdFailureClass(ctx, err)).Inc()
+	}
+	sp.setInt("process.exit_code", cmd.ProcessState.ExitCode())
+	sp.end(err)
+	return err
+}
+
+// lastLine returns the last non-empty line of s, which is where rbd puts
+// its error message.
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
 }
 
 // JSON structs
 
 type poolStatus struct {
-	Images []struct {
-		Name      string `json:"name"`
-		PeerSites []struct {
-			Description string `json:"description"`
-			State       string `json:"state"`
-			LastUpdate  string `json:"last_update"`
-		} `json:"peer_sites"`
-	} `json:"images"`
+	Summary poolSummary    `json:"summary"`
+	Daemons []mirrorDaemon `json:"daemons"`
+	Images  []poolImage    `json:"images"`
+}
+
+// mirrorDaemon is an rbd-mirror daemon servicing the pool, as listed by
+// the verbose status.
+type mirrorDaemon struct {
+	ServiceID   string `json:"service_id"`
+	InstanceID  string `json:"instance_id"`
+	Hostname    string `json:"hostname"`
+	CephVersion string `json:"ceph_version"`
+	Leader      bool   `json:"leader"`
+	Health      string `json:"health"`
+}
+
+// version returns the daemon's version number, stripped of the build hash
+// and release name of "ceph version 17.2.7 (...) quincy (stable)".
+func (d *mirrorDaemon) version() string {
+	f := strings.Fields(strings.TrimPrefix(d.CephVersion, "ceph version "))
+	if len(f) == 0 {
+		return ""
+	}
+	return f[0]
+}
+
+type poolSummary struct {
+	Health       string         `json:"health"`
+	DaemonHealth string         `json:"daemon_health"`
+	ImageHealth  string         `json:"image_health"`
+	States       map[string]int `json:"states"` // image count by state
+}
+
+type poolImage struct {
+	Name string `json:"name"`
+	// Namespace is not part of rbd's output; fetch fills it in.
+	Namespace   string     `json:"namespace,omitempty"`
+	State       string     `json:"state"`
+	Description string     `json:"description"`
+	LastUpdate  string     `json:"last_update"`
+	PeerSites   []peerSite `json:"peer_sites"`
+	// rbd-mirror instance handling the image, if reported
+	DaemonService *daemonService `json:"daemon_service,omitempty"`
+}
+
+type daemonService struct {
+	ServiceID  string `json:"service_id"`
+	InstanceID string `json:"instance_id"`
+	DaemonID   string `json:"daemon_id"`
+	Hostname   string `json:"hostname"`
+}
+
+type peerSite struct {
+	SiteName    string `json:"site_name"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	LastUpdate  string `json:"last_update"`
+
+	// stats decoded by parseStats, nil until then
+	parsed   *snapshotStats
+	parseErr error
+}
+
+// id is the value of the image label: the image name, prefixed with its
+// namespace outside the default one.
+func (img *poolImage) id() string {
+	if img.Namespace == "" {
+		return img.Name
+	}
+	return img.Namespace + "/" + img.Name
+}
+
+// resyncRequested tells whether the status reports a resync requested for
+// the image, by its rbd-mirror description or a peer's.
+func (img *poolImage) resyncRequested() bool {
+	if strings.Contains(strings.ToLower(img.Description), "resync") {
+		return true
+	}
+	for _, p := range img.PeerSites {
+		if strings.Contains(strings.ToLower(p.Description), "resync") {
+			return true
+		}
+	}
+	return false
+}
+
+// role returns the image's mirror role: primary when rbd-mirror reports
+// the local image as primary, non-primary when it replays it from a peer,
+// "" when the status doesn't tell (e.g. the daemon is down or in error).
+func (img *poolImage) role() string {
+	switch {
+	case strings.HasPrefix(img.Description, "local image is primary"):
+		return rolePrimary
+	case replayingStates[img.State]:
+		return roleNonPrimary
+	}
+	return ""
+}
+
+// replayingStates are the states of an image replayed from a peer.
+var replayingStates = map[string]bool{
+	"up+starting_replay": true,
+	"up+replaying":       true,
+	"up+syncing":         true,
+	"up+stopping_replay": true,
+}
+
+// peerSpeedStats summarizes the last sync speeds of an image's peers.
+type peerSpeedStats struct {
+	n             int // peers with stats
+	min, max, sum float64
+	slowest       string // site name of the peer at min
+}
+
+// peerSpeeds returns the speed statistics over the peers that report stats.
+func (img *poolImage) peerSpeeds() peerSpeedStats {
+	var ps peerSpeedStats
+	for i := range img.PeerSites {
+		stats, err := img.PeerSites[i].stats()
+		if err != nil {
+			continue
+		}
+		v := stats.speed()
+		if ps.n == 0 || v < ps.min {
+			ps.min, ps.slowest = v, img.PeerSites[i].SiteName
+		}
+		if ps.n == 0 || v > ps.max {
+			ps.max = v
+		}
+		ps.sum += v
+		ps.n++
+	}
+	return ps
+}
+
+// lastUpdateSkew is how much later the peer last updated its status than
+// the local site did; ok is false unless both timestamps parse.
+func (img *poolImage) lastUpdateSkew() (skew float64, ok bool) {
+	local, err := time.Parse("2006-01-02 15:04:05", img.LastUpdate)
+	if err != nil {
+		return 0, false
+	}
+	peer, err := time.Parse("2006-01-02 15:04:05", img.PeerSites[0].LastUpdate)
+	if err != nil {
+		return 0, false
+	}
+	return peer.Sub(local).Seconds(), true
+}
+
+// syncing tells whether the image or one of its peers is (re)syncing.
+func (img *poolImage) syncing() bool {
+	if strings.HasSuffix(img.State, "syncing") {
+		return true
+	}
+	for _, p := range img.PeerSites {
+		if strings.HasSuffix(p.State, "syncing") {
+			return true
+		}
+	}
+	return false
 }
 
 type snapshotStats struct {
@@ -88,96 +906,704 @@ type snapshotStats struct {
 	BytesPerSnapshot        float64 `json:"bytes_per_snapshot"`
 	LastSnapshotBytes       float64 `json:"last_snapshot_bytes"`
 	LastSnapshotSyncSeconds float64 `json:"last_snapshot_sync_seconds"`
+	LocalSnapshotTimestamp  float64 `json:"local_snapshot_timestamp"`
+	RemoteSnapshotTimestamp float64 `json:"remote_snapshot_timestamp"`
+	ReplayState             string  `json:"replay_state"`
+	// set while replay_state is syncing
+	SyncingPercent float64 `json:"syncing_percent"`
+	// journal-based mirroring reports replay positions instead
+	EntriesBehindPrimary float64          `json:"entries_behind_primary"`
+	PrimaryPosition      *journalPosition `json:"primary_position"`
+	NonPrimaryPosition   *journalPosition `json:"non_primary_position"`
+}
+
+// journalPosition is a position in an image's journal.
+type journalPosition struct {
+	ObjectNumber float64 `json:"object_number"`
+	TagTID       float64 `json:"tag_tid"`
+	EntryTID     float64 `json:"entry_tid"`
+}
+
+// journalObjectSize is the size of the journal objects, 2^rbd_journal_order
+// bytes; set by -journal.object-size.
+var journalObjectSize = 16 << 20
+
+var errNoStats = errors.New("no stats in description")
+
+// stats returns the JSON statistics that snapshot-based mirroring appends
+// to the peer description.
+func (p *peerSite) stats() (snapshotStats, error) {
+	if p.parsed != nil {
+		return *p.parsed, p.parseErr
+	}
+	return p.decodeStats()
+}
+
+func (p *peerSite) decodeStats() (snapshotStats, error) {
+	var stats snapshotStats
+	idx := strings.Index(p.Description, "{")
+	if idx == -1 {
+		return stats, errNoStats
+	}
+	err := json.Unmarshal([]byte(p.Description[idx:]), &stats)
+	return stats, err
+}
+
+// reason is the human readable part of the peer description, e.g.
+// "replaying" or "split-brain detected".
+func (p *peerSite) reason() string {
+	s := p.Description
+	if idx := strings.Index(s, "{"); idx != -1 {
+		s = s[:idx]
+	}
+	return strings.TrimRight(s, ", ")
+}
+
+// truncate cuts s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// speed is the transfer speed of the last snapshot sync (bytes/s).
+func (s snapshotStats) speed() float64 {
+	if s.LastSnapshotSyncSeconds <= 0 {
+		return 0
+	}
+	return s.LastSnapshotBytes / s.LastSnapshotSyncSeconds
+}
+
+// speedMiB is speed in MiB/s.
+func (s snapshotStats) speedMiB() float64 {
+	return s.speed() / 1048576
+}
+
+// lagSeconds is how far the peer's copy trails the newest primary snapshot.
+func (s snapshotStats) lagSeconds() float64 {
+	if s.LocalSnapshotTimestamp == 0 || s.RemoteSnapshotTimestamp < s.LocalSnapshotTimestamp {
+		return 0
+	}
+	return s.RemoteSnapshotTimestamp - s.LocalSnapshotTimestamp
+}
+
+// rpoSeconds is the age of the newest snapshot copied to the peer at now;
+// ok is false before the first copy.
+func (s snapshotStats) rpoSeconds(now time.Time) (rpo float64, ok bool) {
+	if s.LocalSnapshotTimestamp == 0 {
+		return 0, false
+	}
+	return max(0, float64(now.UnixNano())/1e9-s.LocalSnapshotTimestamp), true
+}
+
+// catchupSeconds estimates how long the peer needs to copy the newest
+// primary snapshot: a snapshot's worth of bytes, less what a running sync
+// copied already, at the reported transfer rate, or the last sync's speed
+// without one. ok is false unless the peer is behind and a rate is known.
+func (s snapshotStats) catchupSeconds() (eta float64, ok bool) {
+	if s.lagSeconds() == 0 {
+		return 0, false
+	}
+	rate := s.BytesPerSecond
+	if rate <= 0 {
+		rate = s.speed()
+	}
+	if rate <= 0 {
+		return 0, false
+	}
+	left := s.BytesPerSnapshot
+	if s.ReplayState == "syncing" {
+		left *= 1 - min(s.SyncingPercent, 100)/100
+	}
+	return left / rate, true
+}
+
+// journalLag is how far the peer's replay trails the primary's journal:
+// the entries behind as reported, and the bytes of the journal objects in
+// between, an estimate to the object size. ok is false unless the image
+// mirrors with a journal.
+func (s snapshotStats) journalLag() (entries, bytes float64, ok bool) {
+	if s.PrimaryPosition == nil || s.NonPrimaryPosition == nil {
+		return 0, 0, false
+	}
+	objects := max(0, s.PrimaryPosition.ObjectNumber-s.NonPrimaryPosition.ObjectNumber)
+	return s.EntriesBehindPrimary, objects * float64(journalObjectSize), true
 }
 
 // Prometheus collector
 
+type collectorOptions struct {
+	pool        string
+	labeler     *imageLabeler
+	source      func(ctx context.Context, pool, namespace string) (*poolStatus, error)
+	site        siteLookup
+	vmAggregate string
+	aggregate   bool
+	tracker     *syncTracker
+	shard       *shard
+	leader      *leaderElector
+	descLen     int
+	siteRole    string
+	minInterval time.Duration
+	namespaces  []string
+	imageCols   map[string]bool
+	poolCols    map[string]bool
+	events      *stateBroker
+	health      *healthChecker
+}
+
 type mirrorCollector struct {
-	pool string
+	pool       string
+	labeler    *imageLabeler
+	source     func(ctx context.Context, pool, namespace string) (*poolStatus, error)
+	site       *siteName
+	vms        *vmAggregator
+	aggregate  *poolAggregate // -aggregate-only
+	tracker    *syncTracker
+	shard      *shard
+	leader     *leaderElector
+	descLen    int // image_description_info length limit, 0 = off
+	siteRole   string
+	collectors *collectorStatus
+	namespaces []string
+	nsRollup   *namespaceRollup
+	imageCols  []namedImageCollector
+	poolCols   []namedPoolCollector
+	events     *stateBroker
+	health     *healthChecker
+
+	minInterval time.Duration
+	fetchMu     sync.Mutex // serializes fetches so concurrent scrapes share one
+
+	// outcome of the most recent collection; last doubles as the cache
+	mu       sync.Mutex
+	last     *collection
+	lastOK   time.Time
+	lastTime time.Time
+	lastErr  error
+	warm     *collection // warm-up result not yet served
+
+	// collections served from the cache or the warm-up, and fetched
+	cacheHits, cacheMisses atomic.Uint64
 
-	descSnapSpeed                *prometheus.Desc
-	descSnapBytesPerSnapshot     *prometheus.Desc
-	descSnapLastSnapshotBytes    *prometheus.Desc
+	descSnapSpeed                bytesDesc
+	descSnapBytesPerSnapshot     bytesDesc
+	descSnapLastSnapshotBytes    bytesDesc
 	descSnapLastSnapshotSyncSecs *prometheus.Desc
+	descSnapReportedBPS          *prometheus.Desc
+	descImageRPO                 *prometheus.Desc
+	descReplicationHealthy       *prometheus.Desc
+	descImageCatchup             *prometheus.Desc
+	descJournalEntriesBehind     *prometheus.Desc
+	descJournalLagBytes          *prometheus.Desc
+	descPeerSpeedMin             *prometheus.Desc
+	descPeerSpeedMax             *prometheus.Desc
+	descPeerSpeedAvg             *prometheus.Desc
+	descSlowestPeer              *prometheus.Desc
 	descSnapReplicationState     *prometheus.Desc
 	descSnapLastUpdateTimestamp  *prometheus.Desc
+	descLastUpdateSkew           *prometheus.Desc
+	descPoolImageStates          *prometheus.Desc
+	descPoolSyncing              *prometheus.Desc
+	descDescriptionInfo          *prometheus.Desc
+	descUp                       *prometheus.Desc
+	descRefreshRBD               *prometheus.Desc
+	descCacheHits                *prometheus.Desc
+	descCacheMisses              *prometheus.Desc
+	descCacheImages              *prometheus.Desc
+	descDaemonInfo               *prometheus.Desc
+	descSiteInfo                 *prometheus.Desc
+	descDaemonImages             *prometheus.Desc
+	descImageInstance            *prometheus.Desc
+	descImageResync              *prometheus.Desc
+	descImagePeers               *prometheus.Desc
 }
 
-func NewCollector(pool string) prometheus.Collector {
-	labels := []string{"pool", "image"}
+func NewCollector(opts collectorOptions) *mirrorCollector {
+	labels := append([]string{"pool", "image"}, opts.labeler.Names()...)
 	mp := MetricPrefix
-    return &mirrorCollector{
-		pool: pool,
-		descSnapSpeed:                prometheus.NewDesc(mp+"snapshot_speed_mib_per_sec", "Snapshot sync speed (MiB/s)", labels, nil),
-		descSnapBytesPerSnapshot:     prometheus.NewDesc(mp+"snapshot_bytes_per_snapshot_mib", "Bytes per snapshot (MiB)", labels, nil),
-		descSnapLastSnapshotBytes:    prometheus.NewDesc(mp+"snapshot_last_snapshot_bytes_mib", "Last snapshot size transferred (MiB)", labels, nil),
+	return &mirrorCollector{
+		pool:                         opts.pool,
+		labeler:                      opts.labeler,
+		source:                       opts.source,
+		site:                         newSiteName(opts.site),
+		vms:                          newVMAggregator(opts.vmAggregate, opts.labeler, len(opts.namespaces) > 0),
+		aggregate:                    newPoolAggregate(opts.aggregate),
+		tracker:                      opts.tracker,
+		shard:                        opts.shard,
+		leader:                       opts.leader,
+		descLen:                      opts.descLen,
+		siteRole:                     opts.siteRole,
+		collectors:                   newCollectorStatus(),
+		minInterval:                  opts.minInterval,
+		namespaces:                   opts.namespaces,
+		nsRollup:                     newNamespaceRollup(len(opts.namespaces) > 0),
+		imageCols:                    newImageCollectors(opts.imageCols, labels, opts.tracker),
+		poolCols:                     newPoolCollectors(opts.poolCols, labels),
+		events:                       opts.events,
+		health:                       opts.health,
+		descSnapSpeed:                newBytesDesc("snapshot_speed_bytes_per_second", "snapshot_speed_mib_per_sec", "Snapshot sync speed", labels),
+		descSnapBytesPerSnapshot:     newBytesDesc("snapshot_average_bytes", "snapshot_bytes_per_snapshot_mib", "Bytes per snapshot", labels),
+		descSnapLastSnapshotBytes:    newBytesDesc("snapshot_last_snapshot_bytes", "snapshot_last_snapshot_bytes_mib", "Last snapshot size transferred", labels),
+		descReplicationHealthy:       prometheus.NewDesc(mp+"image_replication_healthy", "Whether the image replicates as expected for -site-role: replaying, and primary on the primary site or non-primary on the secondary (1) or not (0)", labels, nil),
+		descImageRPO:                 prometheus.NewDesc(mp+"image_rpo_seconds", "Age of the newest snapshot copied to the peer, the data lost if the primary failed now (s)", labels, nil),
+		descImageCatchup:             prometheus.NewDesc(mp+"image_estimated_catchup_seconds", "Estimated time until the peer has the newest primary snapshot: the bytes left of it over the reported transfer rate; only for images behind their peer (s)", labels, nil),
+		descJournalEntriesBehind:     prometheus.NewDesc(mp+"image_journal_entries_behind_primary", "Journal entries the peer has yet to replay; only for journal-based mirroring", labels, nil),
+		descJournalLagBytes:          prometheus.NewDesc(mp+"image_journal_lag_bytes", "Estimated journal bytes the peer has yet to replay: the journal objects between the primary and replay positions times -journal.object-size; only for journal-based mirroring (bytes)", labels, nil),
+		descSnapReportedBPS:          prometheus.NewDesc(mp+"snapshot_reported_bytes_per_second", "Transfer rate as reported by rbd-mirror, unlike snapshot_speed_bytes_per_second not derived from the last sync (bytes/s)", labels, nil),
+		descPeerSpeedMin:             prometheus.NewDesc(mp+"snapshot_speed_min_bytes_per_second", "Slowest last snapshot sync speed over the image's peers, for images with several (bytes/s)", labels, nil),
+		descPeerSpeedMax:             prometheus.NewDesc(mp+"snapshot_speed_max_bytes_per_second", "Fastest last snapshot sync speed over the image's peers, for images with several (bytes/s)", labels, nil),
+		descPeerSpeedAvg:             prometheus.NewDesc(mp+"snapshot_speed_avg_bytes_per_second", "Average last snapshot sync speed over the image's peers, for images with several (bytes/s)", labels, nil),
+		descSlowestPeer:              prometheus.NewDesc(mp+"snapshot_slowest_peer_info", "Peer site with the slowest last snapshot sync, for images with several peers (always 1)", append(labels[:len(labels):len(labels)], "site_name"), nil),
 		descSnapLastSnapshotSyncSecs: prometheus.NewDesc(mp+"snapshot_last_snapshot_sync_seconds", "Duration of last snapshot sync (s)", labels, nil),
-		descSnapReplicationState:     prometheus.NewDesc(mp+"snapshot_replication_state", "Replication state (1=OK, 0=Not OK)", append(labels, "state"), nil),
+		descSnapReplicationState:     prometheus.NewDesc(mp+"snapshot_replication_state", "Replication state (1=OK, 0=Not OK)", append(labels[:len(labels):len(labels)], "state"), nil),
 		descSnapLastUpdateTimestamp:  prometheus.NewDesc(mp+"snapshot_last_update_timestamp", "Timestamp of last update (unix)", labels, nil),
-    }
+		descLastUpdateSkew:           prometheus.NewDesc(mp+"image_last_update_skew_seconds", "Peer's last status update less the local one; far from 0 points at clock skew between the sites or one of them no longer reporting (s)", labels, nil),
+		descPoolImageStates:          prometheus.NewDesc(mp+"pool_image_states", "Number of mirrored images by state, from the pool status summary", []string{"pool", "state"}, nil),
+		descPoolSyncing:              prometheus.NewDesc(mp+"pool_images_syncing", "Number of images syncing, locally or on a peer; spikes point at mass resyncs", []string{"pool"}, nil),
+		descRefreshRBD:               prometheus.NewDesc(mp+"refresh_rbd_invocations", "rbd processes started by the last refresh, by subcommand", []string{"subcommand"}, nil),
+		descCacheHits:                prometheus.NewDesc(mp+"cache_hits_total", "Collections served from the cached or warm-up result instead of running rbd (-collect.min-interval)", []string{"pool"}, nil),
+		descCacheMisses:              prometheus.NewDesc(mp+"cache_misses_total", "Collections that had to run rbd", []string{"pool"}, nil),
+		descCacheImages:              prometheus.NewDesc(mp+"cache_images", "Images in the cached result, 0 once it is older than -collect.min-interval", []string{"pool"}, nil),
+		descDaemonInfo:               prometheus.NewDesc(mp+"mirror_daemon_info", "rbd-mirror daemon servicing the pool and its Ceph version (always 1)", []string{"pool", "service_id", "hostname", "ceph_version"}, nil),
+		descDaemonImages:             prometheus.NewDesc(mp+"mirror_daemon_images", "Number of images handled by the rbd-mirror instance", []string{"pool", "instance_id"}, nil),
+		descImageInstance:            prometheus.NewDesc(mp+"image_mirror_instance_info", "rbd-mirror instance handling the image (always 1)", append(labels[:len(labels):len(labels)], "instance_id", "hostname"), nil),
+		descImageResync:              prometheus.NewDesc(mp+"image_resync_requested", "Whether the mirror status reports a resync requested for the image (1) or not (0)", labels, nil),
+		descImagePeers:               prometheus.NewDesc(mp+"image_peer_sites", "Number of peer sites in the image's mirror status", labels, nil),
+		descSiteInfo:                 prometheus.NewDesc(mp+"site_info", "Local site name of the pool's mirroring (always 1)", []string{"pool", "site_name"}, nil),
+		descUp:                       prometheus.NewDesc(mp+"up", "Whether the last collection of the pool succeeded (1) or not (0)", []string{"pool"}, nil),
+		descDescriptionInfo:          prometheus.NewDesc(mp+"image_description_info", "Peer description text without its statistics (always 1)", append(labels[:len(labels):len(labels)], "description"), nil),
+	}
 }
 
 func (c *mirrorCollector) Describe(ch chan<- *prometheus.Desc) {
-    ch <- c.descSnapSpeed
-    ch <- c.descSnapBytesPerSnapshot
-    ch <- c.descSnapLastSnapshotBytes
-    ch <- c.descSnapLastSnapshotSyncSecs
+	c.descSnapSpeed.describe(ch)
+	c.descSnapBytesPerSnapshot.describe(ch)
+	c.descSnapLastSnapshotBytes.describe(ch)
+	ch <- c.descSnapLastSnapshotSyncSecs
+	ch <- c.descSnapReportedBPS
+	ch <- c.descImageRPO
+	ch <- c.descReplicationHealthy
+	ch <- c.descImageCatchup
+	ch <- c.descJournalEntriesBehind
+	ch <- c.descJournalLagBytes
+	ch <- c.descPeerSpeedMin
+	ch <- c.descPeerSpeedMax
+	ch <- c.descPeerSpeedAvg
+	ch <- c.descSlowestPeer
 	ch <- c.descSnapReplicationState
 	ch <- c.descSnapLastUpdateTimestamp
+	ch <- c.descLastUpdateSkew
+	ch <- c.descPoolImageStates
+	ch <- c.descPoolSyncing
+	ch <- c.descUp
+	ch <- c.descRefreshRBD
+	ch <- c.descCacheHits
+	ch <- c.descCacheMisses
+	ch <- c.descCacheImages
+	ch <- c.descDaemonInfo
+	ch <- c.descSiteInfo
+	ch <- c.descDaemonImages
+	ch <- c.descImageInstance
+	ch <- c.descImageResync
+	ch <- c.descImagePeers
+	if c.descLen > 0 {
+		ch <- c.descDescriptionInfo
+	}
+	c.vms.Describe(ch)
+	c.aggregate.Describe(ch)
+	c.nsRollup.Describe(ch)
+	for _, ic := range c.imageCols {
+		ic.Describe(ch)
+	}
+	for _, pc := range c.poolCols {
+		pc.Describe(ch)
+	}
+	c.tracker.Describe(ch)
+	c.collectors.Describe(ch)
 }
 
-func (c *mirrorCollector) Collect(ch chan<- prometheus.Metric) {
-    ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-    defer cancel()
-
-	raw, err := RunRBD(ctx, "mirror", "pool", "status", c.pool, "--verbose", "--format", "json")
-    if err != nil {
-        log.Printf("mirror pool status error: %v", err)
-        return
-    }
+// collection is everything one refresh gathered about the pool.
+type collection struct {
+	status *poolStatus
+	// image collector name -> image id -> data
+	perImage map[string]map[string]any
+	// pool collector name -> data
+	perPool map[string]any
+	// optional collector name -> error of this refresh, nil if it succeeded
+	colErrs map[string]error
+	// rbd subcommand -> processes started by the refresh
+	rbdCalls map[string]int
+	// local site name, "" if unknown
+	site string
+	// image id -> per-image labels, with per-image series only
+	series map[string]*imageSeries
+}
+
+// fetch runs and decodes `rbd mirror pool status` for the pool's default
+// namespace and every configured one, merged into one status, then runs the
+// enabled per-image and pool commands.
+func (c *mirrorCollector) fetch(ctx context.Context) (col *collection, err error) {
+	ctx, sp := startSpan(ctx, "refresh", spanKindInternal)
+	sp.set("ceph.pool", c.pool)
+	defer func() { sp.end(err) }()
+	ctx, calls := withRBDCounter(ctx)
+	var all poolStatus
+	for _, ns := range append([]string{""}, c.namespaces...) {
+		ps, err := c.source(ctx, c.pool, ns)
+		if err != nil {
+			// an aborted scrape says nothing about the cluster
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				c.record(nil, err)
+			}
+			return nil, err
+		}
+		for i := range ps.Images {
+			ps.Images[i].Namespace = ns
+		}
+		sanitizeStates(ps)
+		if all.Images == nil {
+			// no copy without namespaces, the usual case
+			all.Images = ps.Images[:len(ps.Images):len(ps.Images)]
+		} else {
+			all.Images = append(all.Images, ps.Images...)
+		}
+		if ns == "" {
+			all.Daemons = ps.Daemons
+			all.Summary = ps.Summary
+			all.Summary.States = make(map[string]int, len(ps.Summary.States))
+		}
+		for state, n := range ps.Summary.States {
+			all.Summary.States[state] += n
+		}
+	}
+	parseStats(&all)
+	col = &collection{status: &all, colErrs: make(map[string]error), site: c.site.get(ctx, c.pool)}
+	if c.perImageSeries() {
+		col.series = c.buildSeries(&all)
+	}
+	if len(c.imageCols) > 0 {
+		var errs map[string]error
+		col.perImage, errs = c.fetchPerImage(ctx, c.imageCols, all.Images)
+		maps.Copy(col.colErrs, errs)
+	}
+	if len(c.poolCols) > 0 {
+		var errs map[string]error
+		col.perPool, errs = c.fetchPerPool(ctx, c.poolCols, &all)
+		maps.Copy(col.colErrs, errs)
+	}
+	col.rbdCalls = calls.snapshot()
+	c.record(col, nil)
+	return col, nil
+}
+
+// forEachImage runs fn for every image with peers, a few at a time.
+func forEachImage(ctx context.Context, images []poolImage, fn func(ctx context.Context, img *poolImage)) {
+	mirrored := make([]*poolImage, 0, len(images))
+	for i := range images {
+		if len(images[i].PeerSites) > 0 {
+			mirrored = append(mirrored, &images[i])
+		}
+	}
+	forEach(ctx, len(mirrored), func(ctx context.Context, i int) {
+		fn(ctx, mirrored[i])
+	})
+}
+
+func fetchPoolStatus(ctx context.Context, pool, namespace string) (*poolStatus, error) {
+	spec := pool
+	if namespace != "" {
+		spec += "/" + namespace
+	}
+	// streamed, this is the one output growing with the pool
 	var ps poolStatus
-    if err := json.Unmarshal(raw, &ps); err != nil {
-        log.Printf("decode pool status: %v", err)
-        return
-    }
+	if err := runRBDJSON(ctx, &ps, "mirror", "pool", "status", spec, "--verbose", "--format", "json"); err != nil {
+		return nil, fmt.Errorf("mirror pool status error: %w", err)
+	}
+	return &ps, nil
+}
+
+// collection returns the data for a scrape: the pending warm-up result,
+// the cached one if younger than -collect.min-interval, or a fresh fetch.
+func (c *mirrorCollector) collection(ctx context.Context) (*collection, error) {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	c.mu.Lock()
+	col := c.warm
+	c.warm = nil
+	if col == nil && c.last != nil && time.Since(c.lastOK) < c.minInterval {
+		col = c.last
+	}
+	c.mu.Unlock()
+	if col != nil {
+		c.cacheHits.Add(1)
+		return col, nil
+	}
+	c.cacheMisses.Add(1)
+	return c.fetch(ctx)
+}
+
+// collectCache emits how well the cache spares rbd invocations.
+func (c *mirrorCollector) collectCache(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	images := 0
+	if c.last != nil && time.Since(c.lastOK) < c.minInterval {
+		images = len(c.last.status.Images)
+	}
+	c.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(c.descCacheHits, prometheus.CounterValue, float64(c.cacheHits.Load()), c.pool)
+	ch <- prometheus.MustNewConstMetric(c.descCacheMisses, prometheus.CounterValue, float64(c.cacheMisses.Load()), c.pool)
+	ch <- prometheus.MustNewConstMetric(c.descCacheImages, prometheus.GaugeValue, float64(images), c.pool)
+}
 
-    for _, img := range ps.Images {
+// warmUp performs a collection ahead of the first scrape, which is then
+// served from its result.
+func (c *mirrorCollector) warmUp(ctx context.Context) error {
+	col, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.warm = col
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *mirrorCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultScrapeTimeout)
+	defer cancel()
+	c.collect(ctx, ch)
+}
+
+// collect emits the metrics, fetching within ctx if needed.
+func (c *mirrorCollector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	defer recoverPanic("main")
+	if !c.leader.isLeader() {
+		return
+	}
+	col, err := c.collection(ctx)
+	c.collectCache(ch)
+	if err != nil {
+		log.Printf("%v", err)
+		ch <- prometheus.MustNewConstMetric(c.descUp, prometheus.GaugeValue, 0, c.pool)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.descUp, prometheus.GaugeValue, 1, c.pool)
+	ps := col.status
+
+	vms := c.vms.begin()
+	nss := c.nsRollup.begin()
+	agg := c.aggregate.begin()
+	seen := make(map[string]imageSighting, len(ps.Images))
+	now := time.Now()
+	syncing := 0
+	instances := make(map[string]int)
+	for i := range ps.Images {
+		img := &ps.Images[i]
+		id := img.id()
+		owned := c.shard.owns(id)
+		// per-image series of the images this shard owns
+		var series *imageSeries
+		var extra []string
+		if owned && c.perImageSeries() {
+			series = c.seriesOf(col, id)
+			extra = series.values[2:]
+		} else {
+			extra = c.labeler.Values(img.Name)
+		}
+		if series != nil {
+			// zero too: an image that lost all its peers is still listed
+			series.gauge(ch, c.descImagePeers, float64(len(img.PeerSites)))
+		}
 		if len(img.PeerSites) == 0 {
-            continue
-        }
-		peer := img.PeerSites[0]
-		desc := peer.Description
-		idx := strings.Index(desc, "{")
-		if idx == -1 {
-            continue
-        }
-		var stats snapshotStats
-		if err := json.Unmarshal([]byte(desc[idx:]), &stats); err != nil {
-			if Debug {
-				log.Printf("decode stats for %s: %v", img.Name, err)
-			}
-            continue
-        }
-		labels := []string{c.pool, img.Name}
-            speed := 0.0
-		if stats.LastSnapshotSyncSeconds > 0 {
-			speed = (stats.LastSnapshotBytes / stats.LastSnapshotSyncSeconds) / 1048576
-            }
-			ch <- prometheus.MustNewConstMetric(c.descSnapSpeed, prometheus.GaugeValue, speed, labels...)
-		ch <- prometheus.MustNewConstMetric(c.descSnapBytesPerSnapshot, prometheus.GaugeValue, stats.BytesPerSnapshot/1048576, labels...)
-		ch <- prometheus.MustNewConstMetric(c.descSnapLastSnapshotBytes, prometheus.GaugeValue, stats.LastSnapshotBytes/1048576, labels...)
-		ch <- prometheus.MustNewConstMetric(c.descSnapLastSnapshotSyncSecs, prometheus.GaugeValue, stats.LastSnapshotSyncSeconds, labels...)
+			seen[id] = imageSighting{peerless: true}
+			continue
+		}
+		if img.syncing() {
+			syncing++
+		}
+		peer := &img.PeerSites[0]
+		state := c.replicationState(img)
+		resync, role := img.resyncRequested(), img.role()
+		if series != nil {
+			v := 0.0
+			if resync {
+				v = 1
+			}
+			series.gauge(ch, c.descImageResync, v)
+		}
+		if d := img.DaemonService; d != nil && d.InstanceID != "" {
+			instances[d.InstanceID]++
+			if series != nil {
+				ch <- prometheus.MustNewConstMetric(c.descImageInstance, prometheus.GaugeValue, 1, series.with(d.InstanceID, d.Hostname)...)
+			}
+		}
+		if c.descLen > 0 && series != nil {
+			ch <- prometheus.MustNewConstMetric(c.descDescriptionInfo, prometheus.GaugeValue, 1, series.with(sanitizeLabel("description", peer.reason(), c.descLen))...)
+		}
+		// ahead of the stats, which images failing to replay lack
+		if skew, ok := img.lastUpdateSkew(); ok && series != nil {
+			series.gauge(ch, c.descLastUpdateSkew, skew)
+		}
+		stats, err := peer.stats()
+		if err != nil {
+			if Debug.Load() && err != errNoStats {
+				log.Printf("decode stats for %s: %v", id, err)
+			}
+			// no stats, but the disk still counts against the VM's state
+			if owned {
+				vms.add(img.Namespace, extra, state, snapshotStats{})
+			}
+			nss.add(img.Namespace, state, snapshotStats{})
+			agg.add(state, snapshotStats{}, false)
+			seen[id] = imageSighting{resync: resync, role: role}
+			continue
+		}
+		nss.add(img.Namespace, state, stats)
+		agg.add(state, stats, true)
+		seen[id] = imageSighting{stats: stats, resync: resync, role: role}
+		if !owned {
+			continue
+		}
+		vms.add(img.Namespace, extra, state, stats)
+		if series == nil {
+			continue
+		}
+		c.descSnapSpeed.series(ch, series, stats.speed())
+		c.descSnapBytesPerSnapshot.series(ch, series, stats.BytesPerSnapshot)
+		c.descSnapLastSnapshotBytes.series(ch, series, stats.LastSnapshotBytes)
+		series.gauge(ch, c.descSnapLastSnapshotSyncSecs, stats.LastSnapshotSyncSeconds)
+		series.gauge(ch, c.descSnapReportedBPS, stats.BytesPerSecond)
+		if rpo, ok := stats.rpoSeconds(now); ok {
+			series.gauge(ch, c.descImageRPO, rpo)
+		}
+		if eta, ok := stats.catchupSeconds(); ok {
+			series.gauge(ch, c.descImageCatchup, eta)
+		}
+		if entries, bytes, ok := stats.journalLag(); ok {
+			series.gauge(ch, c.descJournalEntriesBehind, entries)
+			series.gauge(ch, c.descJournalLagBytes, bytes)
+		}
+		if ps := img.peerSpeeds(); ps.n > 1 {
+			series.gauge(ch, c.descPeerSpeedMin, ps.min)
+			series.gauge(ch, c.descPeerSpeedMax, ps.max)
+			series.gauge(ch, c.descPeerSpeedAvg, ps.sum/float64(ps.n))
+			ch <- prometheus.MustNewConstMetric(c.descSlowestPeer, prometheus.GaugeValue, 1, series.with(ps.slowest)...)
+		}
 
 		// Replication state: 1 if OK, 0 otherwise
 		replicationOK := 0.0
-		if strings.Contains(peer.State, "replaying") {
+		if strings.Contains(state, "replaying") {
 			replicationOK = 1.0
 		}
-		ch <- prometheus.MustNewConstMetric(c.descSnapReplicationState, prometheus.GaugeValue, replicationOK, append(labels, peer.State)...) 
+		ch <- prometheus.MustNewConstMetric(c.descSnapReplicationState, prometheus.GaugeValue, replicationOK, series.with(state)...)
+		healthy := 0.0
+		if c.replicationHealthy(img, state) {
+			healthy = 1
+		}
+		series.gauge(ch, c.descReplicationHealthy, healthy)
 
 		// Last update timestamp
 		if t, err := time.Parse("2006-01-02 15:04:05", peer.LastUpdate); err == nil {
-			ch <- prometheus.MustNewConstMetric(c.descSnapLastUpdateTimestamp, prometheus.GaugeValue, float64(t.Unix()), labels...)
+			series.gauge(ch, c.descSnapLastUpdateTimestamp, float64(t.Unix()))
+		}
+	}
+	vms.collect(c.pool, ch)
+	if c.shard.primary() {
+		nss.collect(c.pool, ch)
+		agg.collect(c.pool, ch)
+		for state, n := range ps.Summary.States {
+			ch <- prometheus.MustNewConstMetric(c.descPoolImageStates, prometheus.GaugeValue, float64(n), c.pool, state)
+		}
+		ch <- prometheus.MustNewConstMetric(c.descPoolSyncing, prometheus.GaugeValue, float64(syncing), c.pool)
+		for inst, n := range instances {
+			ch <- prometheus.MustNewConstMetric(c.descDaemonImages, prometheus.GaugeValue, float64(n), c.pool, inst)
 		}
-        }
+		if col.site != "" {
+			ch <- prometheus.MustNewConstMetric(c.descSiteInfo, prometheus.GaugeValue, 1, c.pool, col.site)
+		}
+		for i := range ps.Daemons {
+			d := &ps.Daemons[i]
+			ch <- prometheus.MustNewConstMetric(c.descDaemonInfo, prometheus.GaugeValue, 1, c.pool, d.ServiceID, d.Hostname, d.version())
+		}
+	}
+	c.tracker.update(c.pool, seen)
+	var perImage func(id string) *imageSeries
+	if c.perImageSeries() {
+		perImage = func(id string) *imageSeries {
+			if !c.shard.owns(id) {
+				return nil
+			}
+			return c.seriesOf(col, id)
+		}
+	}
+	c.tracker.collect(c.pool, perImage, c.shard.primary(), ch)
+	if c.perImageSeries() {
+		c.collectPerImage(c.imageCols, col.perImage, col.series, ch)
+	}
+	c.collectPerPool(c.poolCols, col.perPool, col.series, ch)
+	c.collectors.collect(ch)
+	for sub, n := range col.rbdCalls {
+		ch <- prometheus.MustNewConstMetric(c.descRefreshRBD, prometheus.GaugeValue, float64(n), sub)
+	}
+}
+
+// perImageSeries tells whether series with an image label are emitted.
+func (c *mirrorCollector) perImageSeries() bool {
+	return !c.vms.only() && c.aggregate == nil
+}
+
+// dry-run outcomes for an image
+const (
+	dryRunExported = "exported"
+	dryRunPartial  = "partial"
+	dryRunSkipped  = "skipped"
+)
+
+// explain tells whether collect exports the per-image series of img, and
+// why not all of them if so.
+func (c *mirrorCollector) explain(img *poolImage) (outcome, reason string) {
+	switch {
+	case c.aggregate != nil:
+		return dryRunSkipped, "-aggregate-only: pool aggregates only"
+	case c.vms.only():
+		return dryRunSkipped, "-vm.aggregate only: per-VM series only"
+	case !c.shard.owns(img.id()):
+		return dryRunSkipped, "owned by another shard (-shard.index)"
+	case len(img.PeerSites) == 0:
+		return dryRunSkipped, "no peer sites, only image_peer_sites"
+	}
+	if _, err := img.PeerSites[0].stats(); err == errNoStats {
+		return dryRunPartial, "no sync stats in the peer description"
+	} else if err != nil {
+		return dryRunPartial, fmt.Sprintf("cannot parse the peer sync stats: %v", err)
+	}
+	if !c.labeler.matches(img.Name) {
+		return dryRunExported, "name does not match -image.label-regex, its labels are empty"
+	}
+	return dryRunExported, ""
+}
+
+func (c *mirrorCollector) record(col *collection, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastTime = time.Now()
+	c.lastErr = err
+	if err != nil {
+		c.health.evaluate(c.pool, nil, err)
+	}
+	if col != nil {
+		// each shard reports on its own images only
+		cur := c.shard.status(col.status)
+		c.health.evaluate(c.pool, cur, nil)
+		var prev *poolStatus
+		if c.last != nil {
+			prev = c.shard.status(c.last.status)
+		}
+		c.events.publish(stateChanges(c.pool, prev, cur, c.lastTime, c.trackedState))
+		c.collectors.record(col.colErrs, c.lastTime)
+		c.last = col
+		c.lastOK = c.lastTime
+	}
 }
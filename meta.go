@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// imageMetaKeys are the image-meta keys the meta collector exports, and
+// imageMetaLabels the label names for them, set from
+// -collector.meta.keys.
+var (
+	imageMetaKeys   []string
+	imageMetaLabels []string
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// parseMetaKeys parses -collector.meta.keys; each key becomes a label of
+// the same name, characters not allowed in label names replaced by _.
+func parseMetaKeys(s string, labeler *imageLabeler) (keys, labels []string, err error) {
+	for _, key := range splitList(s) {
+		name := invalidLabelChars.ReplaceAllString(key, "_")
+		if !validLabelName(name) || slices.Contains(labeler.Names(), name) || slices.Contains(labels, name) {
+			return nil, nil, fmt.Errorf("collector.meta.keys: key %q does not make a usable label name", key)
+		}
+		keys = append(keys, key)
+		labels = append(labels, name)
+	}
+	return keys, labels, nil
+}
+
+// metaCollector exports selected image-meta values, such as an owner or
+// project set by provisioning, for grouping the image series by them.
+type metaCollector struct {
+	descMeta *prometheus.Desc
+}
+
+func newMetaCollector(labels []string) imageCollector {
+	return &metaCollector{
+		descMeta: prometheus.NewDesc(MetricPrefix+"image_meta_info", "Image metadata values of the keys in -collector.meta.keys, empty if unset (always 1)", append(labels[:len(labels):len(labels)], imageMetaLabels...), nil),
+	}
+}
+
+func (m *metaCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.descMeta
+}
+
+func (m *metaCollector) fetch(ctx context.Context, spec string) (any, error) {
+	var meta map[string]string
+	err := runRBDJSON(ctx, &meta, "image-meta", "list", spec, "--format", "json")
+	return meta, err
+}
+
+func (m *metaCollector) collect(ch chan<- prometheus.Metric, labels []string, data any) {
+	meta := data.(map[string]string)
+	values := labels[:len(labels):len(labels)]
+	for i, key := range imageMetaKeys {
+		values = append(values, sanitizeLabel(imageMetaLabels[i], meta[key], stateLabelMax))
+	}
+	ch <- prometheus.MustNewConstMetric(m.descMeta, prometheus.GaugeValue, 1, values...)
+}
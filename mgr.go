@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// -backend values
+const (
+	backendRBD = "rbd"
+	backendMgr = "mgr"
+)
+
+// mgrClient reads the mirroring status from the Ceph mgr dashboard REST
+// API, for hosts that can reach the mgr but have no Ceph packages or
+// keyrings. The API reports the default namespace only, with one status per
+// image in place of rbd's per-peer ones.
+type mgrClient struct {
+	url    string
+	token  func() string
+	client *http.Client
+}
+
+func newMgrClient(baseURL, caFile string, token func() string) (*mgrClient, error) {
+	if baseURL == "" {
+		return nil, errors.New("mgr.url is required with -backend mgr")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("mgr.ca-file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("mgr.ca-file: no certificates in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &mgrClient{
+		url:    strings.TrimSuffix(baseURL, "/"),
+		token:  token,
+		client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// mgrSummary is the response of GET /api/block/mirroring/summary.
+type mgrSummary struct {
+	SiteName    string `json:"site_name"`
+	ContentData struct {
+		Daemons []struct {
+			ID             string `json:"id"`
+			InstanceID     string `json:"instance_id"`
+			Version        string `json:"version"`
+			ServerHostname string `json:"server_hostname"`
+			Leader         bool   `json:"leader"`
+			Health         string `json:"health"`
+		} `json:"daemons"`
+		Pools []struct {
+			Name   string `json:"name"`
+			Health string `json:"health"`
+		} `json:"pools"`
+		ImageError   []mgrImage `json:"image_error"`
+		ImageSyncing []mgrImage `json:"image_syncing"`
+		ImageReady   []mgrImage `json:"image_ready"`
+	} `json:"content_data"`
+}
+
+type mgrImage struct {
+	PoolName    string `json:"pool_name"`
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+func (m *mgrClient) summary(ctx context.Context) (*mgrSummary, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url+"/api/block/mirroring/summary", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.ceph.api.v1.0+json")
+	if token := m.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", req.URL, resp.Status)
+	}
+	var s mgrSummary
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, fmt.Errorf("decode mirroring summary: %w", err)
+	}
+	return &s, nil
+}
+
+// poolStatus converts the mgr's summary to what rbd mirror pool status
+// reports for pool; namespace must be the default one.
+func (m *mgrClient) poolStatus(ctx context.Context, pool, namespace string) (*poolStatus, error) {
+	if namespace != "" {
+		return nil, fmt.Errorf("mgr backend: namespace %s not supported", namespace)
+	}
+	s, err := m.summary(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("mgr mirroring summary: %w", err)
+	}
+	ps := &poolStatus{Summary: poolSummary{States: make(map[string]int)}}
+	found := false
+	for _, p := range s.ContentData.Pools {
+		if p.Name == pool {
+			ps.Summary.Health, found = p.Health, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("mgr mirroring summary: pool %s not mirrored", pool)
+	}
+	for _, d := range s.ContentData.Daemons {
+		ps.Daemons = append(ps.Daemons, mirrorDaemon{
+			ServiceID:   d.ID,
+			InstanceID:  d.InstanceID,
+			Hostname:    d.ServerHostname,
+			CephVersion: d.Version,
+			Leader:      d.Leader,
+			Health:      d.Health,
+		})
+	}
+	for _, list := range [][]mgrImage{s.ContentData.ImageError, s.ContentData.ImageSyncing, s.ContentData.ImageReady} {
+		for _, img := range list {
+			if img.PoolName != pool {
+				continue
+			}
+			state := strings.ToLower(img.State)
+			ps.Summary.States[state]++
+			ps.Images = append(ps.Images, poolImage{
+				Name:        img.Name,
+				State:       state,
+				Description: img.Description,
+				PeerSites:   []peerSite{{State: state, Description: img.Description}},
+			})
+		}
+	}
+	return ps, nil
+}
+
+// siteName returns the local site name from the mgr's summary.
+func (m *mgrClient) siteName(ctx context.Context, _ string) (string, error) {
+	s, err := m.summary(ctx)
+	if err != nil {
+		return "", fmt.Errorf("mgr mirroring summary: %w", err)
+	}
+	return s.SiteName, nil
+}
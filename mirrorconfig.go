@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// mirrorConfigWho is the config section whose values the mirrorconfig
+// collector reads, that of the rbd-mirror daemons by default; set from
+// -collector.mirrorconfig.who.
+var mirrorConfigWho = "client.rbd-mirror"
+
+// Kinds of config values
+const (
+	configCount = iota
+	configBytes
+	configBool
+	configInfo // only in mirror_config_info, e.g. feature lists
+)
+
+// mirrorConfigOption is a Ceph config option exported as a gauge, besides
+// its raw value in mirror_config_info.
+type mirrorConfigOption struct {
+	option string
+	metric string
+	help   string
+	kind   int
+}
+
+// mirrorConfigOptions are the rbd-mirror settings throttling image syncs,
+// a slow sync is as often down to these as to the network, and those that
+// should match between the sites.
+var mirrorConfigOptions = []mirrorConfigOption{
+	{"rbd_mirror_concurrent_image_syncs", "mirror_config_concurrent_image_syncs", "Image syncs an rbd-mirror daemon runs at once (rbd_mirror_concurrent_image_syncs)", configCount},
+	{"rbd_mirror_concurrent_image_deletions", "mirror_config_concurrent_image_deletions", "Image deletions an rbd-mirror daemon runs at once (rbd_mirror_concurrent_image_deletions)", configCount},
+	{"rbd_mirror_memory_target", "mirror_config_memory_target_bytes", "Memory an rbd-mirror daemon aims to use (rbd_mirror_memory_target)", configBytes},
+	{"rbd_mirror_memory_cache_min", "mirror_config_memory_cache_min_bytes", "Least memory an rbd-mirror daemon keeps for caches when autotuning (rbd_mirror_memory_cache_min)", configBytes},
+	{"rbd_mirror_memory_autotune", "mirror_config_memory_autotune", "Whether rbd-mirror autotunes its cache sizes to the memory target (1) or not (0) (rbd_mirror_memory_autotune)", configBool},
+	{"rbd_mirroring_replay_delay", "mirror_config_replay_delay_seconds", "Delay before a non-primary image replays a change (rbd_mirroring_replay_delay)", configCount},
+	{"rbd_default_features", "", "", configInfo},
+}
+
+// mirrorConfigCollector reports rbd-mirror configuration values, read with
+// ceph config get, so that slow syncs can be told apart from throttled ones
+// and settings drifting apart between the sites show.
+type mirrorConfigCollector struct {
+	descs    map[string]*prometheus.Desc // option -> desc
+	descInfo *prometheus.Desc
+}
+
+func newMirrorConfigCollector([]string) poolCollector {
+	m := &mirrorConfigCollector{
+		descs:    make(map[string]*prometheus.Desc, len(mirrorConfigOptions)),
+		descInfo: prometheus.NewDesc(MetricPrefix+"mirror_config_info", "Value of a mirroring config option as ceph config get prints it, to compare between sites (always 1)", []string{"who", "option", "value"}, nil),
+	}
+	for _, o := range mirrorConfigOptions {
+		if o.kind != configInfo {
+			m.descs[o.option] = prometheus.NewDesc(MetricPrefix+o.metric, o.help, []string{"who"}, nil)
+		}
+	}
+	return m
+}
+
+// mirrorConfig is the collector's data, by option; options the cluster
+// does not know are missing.
+type mirrorConfig struct {
+	Values map[string]float64 `json:"values"`
+	Raw    map[string]string  `json:"raw"`
+}
+
+func (m *mirrorConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, o := range mirrorConfigOptions {
+		if d := m.descs[o.option]; d != nil {
+			ch <- d
+		}
+	}
+	ch <- m.descInfo
+}
+
+// parseConfigValue parses a config value as ceph config get prints it;
+// sizes may carry a unit suffix such as 4Gi or 512M.
+func parseConfigValue(s string, kind int) (float64, error) {
+	switch kind {
+	case configBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return 0, err
+		}
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	case configBytes:
+		for i, unit := range []string{"K", "M", "G", "T", "P"} {
+			mult := float64(uint64(1) << (10 * (i + 1)))
+			if n, ok := strings.CutSuffix(s, unit+"i"); ok {
+				s = n
+			} else if n, ok := strings.CutSuffix(s, unit); ok {
+				s = n
+			} else {
+				continue
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			return v * mult, err
+		}
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func (m *mirrorConfigCollector) fetch(ctx context.Context, _ string, _ []string, _ *poolStatus) (any, error) {
+	cfg := &mirrorConfig{
+		Values: make(map[string]float64, len(mirrorConfigOptions)),
+		Raw:    make(map[string]string, len(mirrorConfigOptions)),
+	}
+	for _, o := range mirrorConfigOptions {
+		raw, err := RunCeph(ctx, "config", "get", mirrorConfigWho, o.option)
+		if err != nil {
+			// options older releases don't have yet
+			if strings.Contains(err.Error(), "unrecognized key") {
+				if Debug.Load() {
+					log.Printf("mirrorconfig: %v", err)
+				}
+				continue
+			}
+			return nil, err
+		}
+		value := strings.TrimSpace(string(raw))
+		cfg.Raw[o.option] = value
+		if o.kind == configInfo {
+			continue
+		}
+		v, err := parseConfigValue(value, o.kind)
+		if err != nil {
+			return nil, decodeFailed(fmt.Errorf("parse %s: %w", o.option, err))
+		}
+		cfg.Values[o.option] = v
+	}
+	return cfg, nil
+}
+
+func (m *mirrorConfigCollector) collect(ch chan<- prometheus.Metric, _ string, data any, _ func(string) []string) {
+	cfg := data.(*mirrorConfig)
+	for _, o := range mirrorConfigOptions {
+		if v, ok := cfg.Values[o.option]; ok {
+			ch <- prometheus.MustNewConstMetric(m.descs[o.option], prometheus.GaugeValue, v, mirrorConfigWho)
+		}
+		if raw, ok := cfg.Raw[o.option]; ok {
+			ch <- prometheus.MustNewConstMetric(m.descInfo, prometheus.GaugeValue, 1, mirrorConfigWho, o.option, sanitizeLabel("value", raw, stateLabelMax))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// namespaceRollup emits per-namespace aggregates so tenants mapped to RBD
+// namespaces can be monitored without per-image series. A nil rollup is
+// disabled.
+type namespaceRollup struct {
+	descImages *prometheus.Desc
+	descBPS    bytesDesc
+	descLast   bytesDesc
+}
+
+func newNamespaceRollup(enabled bool) *namespaceRollup {
+	if !enabled {
+		return nil
+	}
+	labels := []string{"pool", "namespace"}
+	mp := MetricPrefix
+	return &namespaceRollup{
+		descImages: prometheus.NewDesc(mp+"namespace_images", "Mirrored images in the namespace by peer state", append(labels[:2:2], "state"), nil),
+		descBPS:    newBytesDesc("namespace_snapshot_average_bytes", "namespace_snapshot_bytes_per_snapshot_mib", "Bytes per snapshot summed over the namespace's images", labels),
+		descLast:   newBytesDesc("namespace_snapshot_last_snapshot_bytes", "namespace_snapshot_last_snapshot_bytes_mib", "Last snapshot size transferred summed over the namespace's images", labels),
+	}
+}
+
+func (n *namespaceRollup) Describe(ch chan<- *prometheus.Desc) {
+	if n == nil {
+		return
+	}
+	ch <- n.descImages
+	n.descBPS.describe(ch)
+	n.descLast.describe(ch)
+}
+
+type namespaceTotals struct {
+	states            map[string]int
+	bytesPerSnapshot  float64
+	lastSnapshotBytes float64
+}
+
+// namespaceRun accumulates totals for a single collection.
+type namespaceRun struct {
+	n   *namespaceRollup
+	nss map[string]*namespaceTotals
+}
+
+func (n *namespaceRollup) begin() *namespaceRun {
+	if n == nil {
+		return nil
+	}
+	return &namespaceRun{n: n, nss: make(map[string]*namespaceTotals)}
+}
+
+func (r *namespaceRun) add(namespace, state string, stats snapshotStats) {
+	if r == nil {
+		return
+	}
+	t := r.nss[namespace]
+	if t == nil {
+		t = &namespaceTotals{states: make(map[string]int)}
+		r.nss[namespace] = t
+	}
+	t.states[state]++
+	t.bytesPerSnapshot += stats.BytesPerSnapshot
+	t.lastSnapshotBytes += stats.LastSnapshotBytes
+}
+
+func (r *namespaceRun) collect(pool string, ch chan<- prometheus.Metric) {
+	if r == nil {
+		return
+	}
+	n := r.n
+	for ns, t := range r.nss {
+		for state, count := range t.states {
+			ch <- prometheus.MustNewConstMetric(n.descImages, prometheus.GaugeValue, float64(count), pool, ns, state)
+		}
+		n.descBPS.gauge(ch, t.bytesPerSnapshot, pool, ns)
+		n.descLast.gauge(ch, t.lastSnapshotBytes, pool, ns)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification events
+const (
+	eventError            = "error"
+	eventRecovered        = "recovered"
+	eventStoppedReplaying = "stopped_replaying"
+	eventResumedReplaying = "resumed_replaying"
+)
+
+func isErrorState(s string) bool     { return strings.Contains(s, "error") }
+func isReplayingState(s string) bool { return strings.Contains(s, "replaying") }
+
+// classify names the event worth notifying about for a transition, or "".
+func classify(from, to string) string {
+	switch {
+	case to == "":
+		// image removed
+		return ""
+	case !isErrorState(from) && isErrorState(to):
+		return eventError
+	case isErrorState(from) && !isErrorState(to):
+		return eventRecovered
+	case isReplayingState(from) && !isReplayingState(to):
+		return eventStoppedReplaying
+	case from != "" && !isReplayingState(from) && isReplayingState(to):
+		return eventResumedReplaying
+	}
+	return ""
+}
+
+// notification is the JSON body POSTed to webhooks.
+type notification struct {
+	Event    string    `json:"event"`
+	Pool     string    `json:"pool"`
+	Image    string    `json:"image"`
+	OldState string    `json:"old_state"`
+	NewState string    `json:"new_state"`
+	Since    time.Time `json:"since"`
+}
+
+// pendingChange is a transition waiting out the debounce period.
+type pendingChange struct {
+	from  string
+	to    string
+	since time.Time
+	timer *time.Timer
+}
+
+// notifySink delivers notifications somewhere.
+type notifySink interface {
+	name() string
+	notify(msg notification) error
+}
+
+// webhookSink POSTs notifications as JSON to a URL.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSink(url string) *webhookSink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *webhookSink) name() string { return w.url }
+
+func (w *webhookSink) notify(msg notification) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return postJSON(w.client, w.url, body)
+}
+
+func postJSON(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// notifier sends state transitions to its sinks once they have persisted
+// for the debounce period, so flapping images don't page anyone.
+type notifier struct {
+	sinks    []notifySink
+	debounce time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingChange // pool/image
+}
+
+func newNotifier(sinks []notifySink, debounce time.Duration) *notifier {
+	return &notifier{
+		sinks:    sinks,
+		debounce: debounce,
+		pending:  make(map[string]*pendingChange),
+	}
+}
+
+// run consumes state changes from events until ctx ends.
+func (n *notifier) run(ctx context.Context, events *stateBroker) {
+	ch, cancel := events.subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-ch:
+			n.observe(c)
+		}
+	}
+}
+
+func (n *notifier) observe(c stateChange) {
+	key := c.Pool + "/" + c.Image
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	p := n.pending[key]
+	if p != nil {
+		// still within the window: compare against the state before it
+		p.to = c.NewState
+		p.timer.Reset(n.debounce)
+		return
+	}
+	if classify(c.OldState, c.NewState) == "" {
+		return
+	}
+	p = &pendingChange{from: c.OldState, to: c.NewState, since: c.Time}
+	p.timer = time.AfterFunc(n.debounce, func() { n.fire(key, c.Pool, c.Image) })
+	n.pending[key] = p
+}
+
+func (n *notifier) fire(key, pool, image string) {
+	n.mu.Lock()
+	p := n.pending[key]
+	delete(n.pending, key)
+	n.mu.Unlock()
+	if p == nil {
+		return
+	}
+	event := classify(p.from, p.to)
+	if event == "" {
+		return
+	}
+	n.send(notification{Event: event, Pool: pool, Image: image, OldState: p.from, NewState: p.to, Since: p.since})
+}
+
+func (n *notifier) send(msg notification) {
+	for _, sink := range n.sinks {
+		if err := sink.notify(msg); err != nil {
+			log.Printf("notify %s: %v", sink.name(), err)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// oidcVerifier checks bearer tokens issued by an OIDC provider: JWTs
+// signed with one of the provider's JWKS keys, for the configured audience
+// and not expired. A nil verifier lets every request through.
+type oidcVerifier struct {
+	issuer   string
+	audience string
+	jwksURL  string // discovered from the issuer if empty
+	client   *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey // by kid
+	fetched time.Time
+}
+
+// oidcLeeway is the clock skew tolerated when checking exp and nbf.
+const oidcLeeway = time.Minute
+
+// oidcRefetch limits how often unknown key ids trigger a JWKS refetch;
+// known keys are refreshed after oidcKeysTTL so that revoked ones go away.
+const (
+	oidcRefetch = time.Minute
+	oidcKeysTTL = time.Hour
+)
+
+func newOIDCVerifier(issuer, jwksURL, audience string) (*oidcVerifier, error) {
+	if issuer == "" && jwksURL == "" {
+		return nil, nil
+	}
+	if audience == "" {
+		return nil, errors.New("web.oidc-audience is required with OIDC authentication")
+	}
+	return &oidcVerifier{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		jwksURL:  jwksURL,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	Expiry    int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+}
+
+// audience is the aud claim, a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func decodeSegment(s string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// verify checks token and returns why it is not acceptable.
+func (v *oidcVerifier) verify(ctx context.Context, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+	var hdr jwtHeader
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return fmt.Errorf("token header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("token signature: %w", err)
+	}
+	key, err := v.key(ctx, hdr.Kid)
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(hdr.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return err
+	}
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return fmt.Errorf("token claims: %w", err)
+	}
+	now := time.Now()
+	switch {
+	case v.issuer != "" && strings.TrimSuffix(claims.Issuer, "/") != v.issuer:
+		return fmt.Errorf("issuer %q not accepted", claims.Issuer)
+	case !slices.Contains(claims.Audience, v.audience):
+		return fmt.Errorf("audience %v not accepted", []string(claims.Audience))
+	case claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(oidcLeeway)):
+		return errors.New("token expired")
+	case claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-oidcLeeway)):
+		return errors.New("token not yet valid")
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, input string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	if hash == 0 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(input))
+	digest := h.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+		case "PS":
+			return rsa.VerifyPSS(k, hash, digest, sig, nil)
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] == "ES" && len(sig)%2 == 0 {
+			r := new(big.Int).SetBytes(sig[:len(sig)/2])
+			s := new(big.Int).SetBytes(sig[len(sig)/2:])
+			if !ecdsa.Verify(k, digest, r, s) {
+				return errors.New("invalid signature")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("algorithm %q does not match key", alg)
+}
+
+// key returns the signing key kid, refetching the JWKS if it is unknown.
+// The fetch runs without v.mu held, so that a slow provider only holds
+// up the request that triggered it; others go by the keys at hand.
+func (v *oidcVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	k, ok := v.keys[kid]
+	age := time.Since(v.fetched)
+	jwksURL := v.jwksURL
+	if ok && age < oidcKeysTTL {
+		v.mu.Unlock()
+		return k, nil
+	}
+	if !ok && age < oidcRefetch {
+		v.mu.Unlock()
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	v.fetched = time.Now()
+	v.mu.Unlock()
+	keys, jwksURL, err := v.fetchKeys(ctx, jwksURL)
+	if err != nil {
+		if ok {
+			// keep using the known key while the provider is unreachable
+			return k, nil
+		}
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	v.mu.Lock()
+	v.keys, v.jwksURL = keys, jwksURL
+	v.mu.Unlock()
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (v *oidcVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys loads the provider's signing keys from jwksURL, discovering it
+// from the issuer if empty, and returns them with the URL used.
+func (v *oidcVerifier) fetchKeys(ctx context.Context, jwksURL string) (map[string]crypto.PublicKey, string, error) {
+	if jwksURL == "" {
+		var disc struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, v.issuer+"/.well-known/openid-configuration", &disc); err != nil {
+			return nil, "", err
+		}
+		if disc.JWKSURI == "" {
+			return nil, "", errors.New("discovery document has no jwks_uri")
+		}
+		jwksURL = disc.JWKSURI
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(ctx, jwksURL, &set); err != nil {
+		return nil, "", err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if k, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = k
+		}
+	}
+	return keys, jwksURL, nil
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	num := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		return new(big.Int).SetBytes(b), err
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := num(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := num(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := num(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := num(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// bearerToken extracts the token from an Authorization header value.
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// wrap requires a valid bearer token for every request to h.
+func (v *oidcVerifier) wrap(h http.Handler) http.Handler {
+	if v == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r.Header.Get("Authorization"))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ceph_vm_exporter"`)
+			http.Error(w, "bearer token required", http.StatusUnauthorized)
+			return
+		}
+		if err := v.verify(r.Context(), token); err != nil {
+			if Debug.Load() {
+				log.Printf("[DEBUG] rejected token from %s: %v", r.RemoteAddr, err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ceph_vm_exporter", error="invalid_token"`)
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authorizeGRPC checks the bearer token in the call's metadata.
+func (v *oidcVerifier) authorizeGRPC(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range md.Get("authorization") {
+		if token, ok := bearerToken(header); ok {
+			if err := v.verify(ctx, token); err != nil {
+				return status.Error(codes.Unauthenticated, "invalid token")
+			}
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "bearer token required")
+}
+
+// serverOptions returns the gRPC interceptors enforcing authentication.
+func (v *oidcVerifier) serverOptions() []grpc.ServerOption {
+	if v == nil {
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := v.authorizeGRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := v.authorizeGRPC(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// orphanCollector counts mirror snapshots left behind on images that are no
+// longer mirrored, or whose peer is gone; these typically accumulate after
+// DR tests and hold on to space nobody accounts for.
+type orphanCollector struct {
+	descSnapshots *prometheus.Desc
+	descImages    *prometheus.Desc
+}
+
+func newOrphanCollector([]string) poolCollector {
+	mp := MetricPrefix
+	labels := []string{"pool"}
+	return &orphanCollector{
+		descSnapshots: prometheus.NewDesc(mp+"pool_orphaned_mirror_snapshots", "Mirror snapshots on images without mirroring or without peers", labels, nil),
+		descImages:    prometheus.NewDesc(mp+"pool_orphaned_mirror_snapshot_images", "Images without mirroring or without peers that still have mirror snapshots", labels, nil),
+	}
+}
+
+type orphanCounts struct {
+	Snapshots int `json:"snapshots"`
+	Images    int `json:"images"`
+}
+
+func (o *orphanCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- o.descSnapshots
+	ch <- o.descImages
+}
+
+func (o *orphanCollector) fetch(ctx context.Context, pool string, namespaces []string, status *poolStatus) (any, error) {
+	ids, err := listImages(ctx, pool, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	mirrored := make(map[string]bool, len(status.Images))
+	for i := range status.Images {
+		if len(status.Images[i].PeerSites) > 0 {
+			mirrored[status.Images[i].id()] = true
+		}
+	}
+	var candidates []string
+	for _, id := range ids {
+		if !mirrored[id] {
+			candidates = append(candidates, id)
+		}
+	}
+	var mu sync.Mutex
+	counts := &orphanCounts{}
+	forEach(ctx, len(candidates), func(ctx context.Context, i int) {
+		spec := pool + "/" + candidates[i]
+		var snaps []rbdSnapshot
+		if err := runRBDJSON(ctx, &snaps, "snap", "ls", "--all", spec, "--format", "json"); err != nil {
+			// the image may have been removed since the listing
+			if Debug.Load() {
+				log.Printf("orphans collector %s: %v", spec, err)
+			}
+			return
+		}
+		n := 0
+		for j := range snaps {
+			if snaps[j].isMirror() {
+				n++
+			}
+		}
+		if n == 0 {
+			return
+		}
+		mu.Lock()
+		counts.Snapshots += n
+		counts.Images++
+		mu.Unlock()
+	})
+	return counts, ctx.Err()
+}
+
+func (o *orphanCollector) collect(ch chan<- prometheus.Metric, pool string, data any, _ func(string) []string) {
+	counts := data.(*orphanCounts)
+	ch <- prometheus.MustNewConstMetric(o.descSnapshots, prometheus.GaugeValue, float64(counts.Snapshots), pool)
+	ch <- prometheus.MustNewConstMetric(o.descImages, prometheus.GaugeValue, float64(counts.Images), pool)
+}
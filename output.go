@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sample is one flattened series value, as push outputs need them.
+type sample struct {
+	name   string
+	labels []*dto.LabelPair // sorted by name
+	value  float64
+}
+
+// flatten turns the exporter's own metric families into samples; histograms
+// become _bucket (with le), _sum and _count samples, summaries quantile
+// (with quantile), _sum and _count ones. Non-finite values are dropped
+// since most push targets reject them.
+func flatten(mfs []*dto.MetricFamily) []sample {
+	var out []sample
+	add := func(name string, labels []*dto.LabelPair, v float64) {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+		out = append(out, sample{name: name, labels: labels, value: v})
+	}
+	with := func(labels []*dto.LabelPair, name, value string) []*dto.LabelPair {
+		l := append(labels[:len(labels):len(labels)], &dto.LabelPair{Name: &name, Value: &value})
+		sort.Slice(l, func(i, j int) bool { return l[i].GetName() < l[j].GetName() })
+		return l
+	}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if !strings.HasPrefix(name, MetricPrefix) {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := m.GetLabel()
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, labels, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, labels, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, labels, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add(name+"_bucket", with(labels, "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)), float64(b.GetCumulativeCount()))
+				}
+				add(name+"_bucket", with(labels, "le", "+Inf"), float64(h.GetSampleCount()))
+				add(name+"_sum", labels, h.GetSampleSum())
+				add(name+"_count", labels, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				sm := m.GetSummary()
+				for _, q := range sm.GetQuantile() {
+					add(name, with(labels, "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)), q.GetValue())
+				}
+				add(name+"_sum", labels, sm.GetSampleSum())
+				add(name+"_count", labels, float64(sm.GetSampleCount()))
+			}
+		}
+	}
+	return out
+}
+
+// pushLoop gathers g every interval and hands the samples to push, until
+// ctx ends. Gathering runs the collectors like a scrape would.
+func pushLoop(ctx context.Context, name string, interval time.Duration, g prometheus.Gatherer, push func(ctx context.Context, now time.Time, samples []sample) error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		mfs, err := g.Gather()
+		if err != nil {
+			log.Printf("%s: gather: %v", name, err)
+		}
+		pctx, cancel := context.WithTimeout(ctx, interval)
+		if err := push(pctx, time.Now(), flatten(mfs)); err != nil {
+			log.Printf("%s: %v", name, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseCollectorPaths parses -web.collector-paths, a comma-separated list
+// of collector=path, into collector name -> path.
+func parseCollectorPaths(s string) (map[string]string, error) {
+	known := make(map[string]bool)
+	for _, ic := range imageCollectors {
+		known[ic.name] = true
+	}
+	for _, pc := range poolCollectors {
+		known[pc.name] = true
+	}
+	paths := make(map[string]string)
+	for _, item := range splitList(s) {
+		name, path, ok := strings.Cut(item, "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("web.collector-paths: %q is not collector=/path", item)
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("web.collector-paths: unknown collector %q", name)
+		}
+		paths[name] = path
+	}
+	return paths, nil
+}
+
+// detachedCollector runs some optional collectors on their own, when its
+// path is scraped, rather than in every refresh of the main collector; so
+// expensive ones can be scraped less often. Images are taken from the main
+// collector's last pool status.
+type detachedCollector struct {
+	c         *mirrorCollector
+	imageCols []namedImageCollector
+	poolCols  []namedPoolCollector
+}
+
+func (c *mirrorCollector) detach(names []string) *detachedCollector {
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		enabled[name] = true
+	}
+	labels := append([]string{"pool", "image"}, c.labeler.Names()...)
+	return &detachedCollector{
+		c:         c,
+		imageCols: newImageCollectors(enabled, labels, c.tracker),
+		poolCols:  newPoolCollectors(enabled, labels),
+	}
+}
+
+// status returns the last pool status, fetching one if there is none yet.
+func (c *mirrorCollector) status(ctx context.Context) (*poolStatus, error) {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	c.mu.Lock()
+	col := c.last
+	c.mu.Unlock()
+	if col != nil {
+		return col.status, nil
+	}
+	col, err := c.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return col.status, nil
+}
+
+func (d *detachedCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, ic := range d.imageCols {
+		ic.Describe(ch)
+	}
+	for _, pc := range d.poolCols {
+		pc.Describe(ch)
+	}
+}
+
+func (d *detachedCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultScrapeTimeout)
+	defer cancel()
+	d.collect(ctx, ch)
+}
+
+func (d *detachedCollector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	c := d.c
+	if !c.leader.isLeader() {
+		return
+	}
+	ps, err := c.status(ctx)
+	if err != nil {
+		return
+	}
+	if len(d.imageCols) > 0 && c.perImageSeries() {
+		perImage, errs := c.fetchPerImage(ctx, d.imageCols, ps.Images)
+		c.collectors.record(errs, time.Now())
+		c.collectPerImage(d.imageCols, perImage, nil, ch)
+	}
+	if len(d.poolCols) > 0 {
+		perPool, errs := c.fetchPerPool(ctx, d.poolCols, ps)
+		c.collectors.record(errs, time.Now())
+		c.collectPerPool(d.poolCols, perPool, nil, ch)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector is an optional collector gathering pool-wide data once per
+// refresh, enabled with -collector.<name> like the image collectors.
+type poolCollector interface {
+	Describe(ch chan<- *prometheus.Desc)
+	// fetch gathers the data for pool; namespaces are the scanned ones
+	// ("" first) and status their merged mirror status.
+	fetch(ctx context.Context, pool string, namespaces []string, status *poolStatus) (any, error)
+	// collect emits the series for pool; imageLabels gives the per-image
+	// label values for an image id and is nil when per-image series are
+	// disabled.
+	collect(ch chan<- prometheus.Metric, pool string, data any, imageLabels func(id string) []string)
+}
+
+type poolCollectorInfo struct {
+	name string
+	help string
+	// new gets the per-image label names, for collectors that emit
+	// per-image series from pool-wide data
+	new func(labels []string) poolCollector
+}
+
+// poolCollectors lists the available pool collectors, all off by default.
+var poolCollectors = []poolCollectorInfo{
+	{"orphans", "orphaned mirror snapshot (rbd ls, rbd snap ls --all)", newOrphanCollector},
+	{"schedules", "mirror snapshot schedule (rbd mirror snapshot schedule status)", newScheduleCollector},
+	{"poolinfo", "mirroring configuration (rbd mirror pool info)", newPoolInfoCollector},
+	{"coverage", "mirroring coverage (rbd ls)", newCoverageCollector},
+	{"blocklist", "mirror client blocklist (ceph osd blocklist ls)", newBlocklistCollector},
+	{"trash", "trash backlog and purge schedule (rbd trash ls, rbd trash purge schedule)", newTrashCollector},
+	{"mirrorconfig", "rbd-mirror sync throttle and mirroring configuration (ceph config get)", newMirrorConfigCollector},
+}
+
+type namedPoolCollector struct {
+	name string
+	poolCollector
+}
+
+func newPoolCollectors(enabled map[string]bool, labels []string) []namedPoolCollector {
+	var out []namedPoolCollector
+	for _, info := range poolCollectors {
+		if enabled[info.name] {
+			out = append(out, namedPoolCollector{info.name, info.new(labels)})
+		}
+	}
+	return out
+}
+
+// fetchPerPool runs cols, on the primary shard only; failed ones are left
+// out of the data, and errs has an entry for every collector run.
+func (c *mirrorCollector) fetchPerPool(ctx context.Context, cols []namedPoolCollector, status *poolStatus) (out map[string]any, errs map[string]error) {
+	out = make(map[string]any, len(cols))
+	errs = make(map[string]error, len(cols))
+	if !c.shard.primary() {
+		return out, errs
+	}
+	namespaces := append([]string{""}, c.namespaces...)
+	for _, pc := range cols {
+		data, err := pc.fetch(ctx, c.pool, namespaces, status)
+		if err != nil {
+			log.Printf("%s collector %s: %v", pc.name, c.pool, err)
+			errs[pc.name] = contextError(ctx, err)
+			continue
+		}
+		errs[pc.name] = nil
+		out[pc.name] = data
+	}
+	return out, errs
+}
+
+// collectPerPool emits the series of cols from perPool; series is as for
+// collectPerImage.
+func (c *mirrorCollector) collectPerPool(cols []namedPoolCollector, perPool map[string]any, series map[string]*imageSeries, ch chan<- prometheus.Metric) {
+	var imageLabels func(id string) []string
+	if c.perImageSeries() {
+		imageLabels = func(id string) []string { return c.labelValues(series, id) }
+	}
+	for _, pc := range cols {
+		if data, ok := perPool[pc.name]; ok {
+			func() {
+				defer recoverPanic(pc.name)
+				pc.collect(ch, c.pool, data, imageLabels)
+			}()
+		}
+	}
+}
+
+// listImages returns the ids of all images in pool's namespaces.
+func listImages(ctx context.Context, pool string, namespaces []string) ([]string, error) {
+	var ids []string
+	for _, ns := range namespaces {
+		spec := pool
+		if ns != "" {
+			spec += "/" + ns
+		}
+		var names []string
+		if err := runRBDJSON(ctx, &names, "ls", spec, "--format", "json"); err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			ids = append(ids, (&poolImage{Name: name, Namespace: ns}).id())
+		}
+	}
+	return ids, nil
+}
+
+// forEach runs fn for 0..n-1, as many at a time as rbd processes may run.
+func forEach(ctx context.Context, n int, fn func(ctx context.Context, i int)) {
+	workers := 4
+	if rbdSlots != nil {
+		workers = cap(rbdSlots)
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				fn(ctx, i)
+			}
+		}()
+	}
+	for i := range n {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+}
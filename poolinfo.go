@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// mirrorModes are the pool mirroring modes, all exported so that a change
+// away from the expected one can be alerted on.
+var mirrorModes = []string{"pool", "image", "disabled"}
+
+// peerDirections are the directions a pool peer can be mirrored in, from
+// the local cluster's point of view.
+var peerDirections = []string{"rx-only", "tx-only", "rx-tx"}
+
+// peerAttributes has the poolinfo collector read the peers' monitor hosts
+// and keys too (rbd mirror pool info --all), set from
+// -collector.poolinfo.peer-attributes; that takes more capabilities.
+var peerAttributes bool
+
+// expectedPeers is the number of peers every pool should have, set from
+// -collector.poolinfo.expected-peers; 0 expects nothing.
+var expectedPeers int
+
+// poolInfoCollector reports the pool's mirroring configuration.
+type poolInfoCollector struct {
+	descMode       *prometheus.Desc
+	descDirection  *prometheus.Desc
+	descPeers      *prometheus.Desc
+	descExpected   *prometheus.Desc
+	descAsExpected *prometheus.Desc
+	descPeerInfo   *prometheus.Desc
+}
+
+func newPoolInfoCollector([]string) poolCollector {
+	return &poolInfoCollector{
+		descMode:       prometheus.NewDesc(MetricPrefix+"pool_mirror_mode", "Mirroring mode of the pool (1 for the current mode)", []string{"pool", "mode"}, nil),
+		descDirection:  prometheus.NewDesc(MetricPrefix+"pool_peer_direction", "Mirroring direction of the pool peer (1 for the current direction)", []string{"pool", "peer", "direction"}, nil),
+		descPeers:      prometheus.NewDesc(MetricPrefix+"pool_peers_configured", "Number of peers configured for the pool's mirroring", []string{"pool"}, nil),
+		descExpected:   prometheus.NewDesc(MetricPrefix+"pool_peers_expected", "Number of peers the pool should have, from -collector.poolinfo.expected-peers", []string{"pool"}, nil),
+		descPeerInfo:   prometheus.NewDesc(MetricPrefix+"pool_peer_info", "Pool peer attributes: client name and, with -collector.poolinfo.peer-attributes, a fingerprint of the monitor hosts and whether a key is stored, never the key itself (always 1)", []string{"pool", "peer", "client_name", "mon_host_fingerprint", "key_set"}, nil),
+		descAsExpected: prometheus.NewDesc(MetricPrefix+"pool_peers_as_expected", "Whether the pool has the expected number of peers (1) or not (0), e.g. after a peer was removed or a bootstrap left unfinished", []string{"pool"}, nil),
+	}
+}
+
+// mirrorPoolInfo is the output of `rbd mirror pool info --format json`.
+type mirrorPoolInfo struct {
+	Mode     string     `json:"mode"`
+	SiteName string     `json:"site_name"`
+	Peers    []poolPeer `json:"peers"`
+}
+
+type poolPeer struct {
+	UUID       string `json:"uuid"`
+	Direction  string `json:"direction"`
+	SiteName   string `json:"site_name"`
+	ClientName string `json:"client_name"`
+	// with --all only; the key is dropped right after decoding
+	MonHost string `json:"mon_host"`
+	Key     string `json:"key"`
+	keySet  bool
+}
+
+// monHostFingerprint identifies the peer's monitor addresses regardless of
+// their order, "" if unknown.
+func (p *poolPeer) monHostFingerprint() string {
+	addrs := strings.FieldsFunc(p.MonHost, func(r rune) bool { return r == ',' || r == ' ' || r == '[' || r == ']' })
+	if len(addrs) == 0 {
+		return ""
+	}
+	slices.Sort(addrs)
+	sum := sha256.Sum256([]byte(strings.Join(addrs, ",")))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// name identifies the peer by site name, or by UUID for peers added
+// without one.
+func (p *poolPeer) name() string {
+	if p.SiteName != "" {
+		return p.SiteName
+	}
+	return p.UUID
+}
+
+func (p *poolInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.descMode
+	ch <- p.descDirection
+	ch <- p.descPeers
+	ch <- p.descExpected
+	ch <- p.descAsExpected
+	ch <- p.descPeerInfo
+}
+
+func (p *poolInfoCollector) fetch(ctx context.Context, pool string, _ []string, _ *poolStatus) (any, error) {
+	var info mirrorPoolInfo
+	args := []string{"mirror", "pool", "info", pool, "--format", "json"}
+	if peerAttributes {
+		args = append(args, "--all")
+	}
+	err := runRBDJSON(ctx, &info, args...)
+	for i := range info.Peers {
+		info.Peers[i].keySet = info.Peers[i].Key != ""
+		info.Peers[i].Key = ""
+	}
+	return &info, err
+}
+
+func (p *poolInfoCollector) collect(ch chan<- prometheus.Metric, pool string, data any, _ func(string) []string) {
+	info := data.(*mirrorPoolInfo)
+	for _, mode := range mirrorModes {
+		v := 0.0
+		if info.Mode == mode {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(p.descMode, prometheus.GaugeValue, v, pool, mode)
+	}
+	for i := range info.Peers {
+		peer := &info.Peers[i]
+		for _, dir := range peerDirections {
+			v := 0.0
+			if peer.Direction == dir {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(p.descDirection, prometheus.GaugeValue, v, pool, peer.name(), dir)
+		}
+		keySet := ""
+		if peerAttributes {
+			keySet = strconv.FormatBool(peer.keySet)
+		}
+		ch <- prometheus.MustNewConstMetric(p.descPeerInfo, prometheus.GaugeValue, 1, pool, peer.name(), peer.ClientName, peer.monHostFingerprint(), keySet)
+	}
+	ch <- prometheus.MustNewConstMetric(p.descPeers, prometheus.GaugeValue, float64(len(info.Peers)), pool)
+	if expectedPeers > 0 {
+		v := 0.0
+		if len(info.Peers) == expectedPeers {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(p.descExpected, prometheus.GaugeValue, float64(expectedPeers), pool)
+		ch <- prometheus.MustNewConstMetric(p.descAsExpected, prometheus.GaugeValue, v, pool)
+	}
+}
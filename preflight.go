@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// preflight checks that rbd can be run, authenticates and can read the
+// mirroring setup of pool and its namespaces, so that a broken setup fails
+// at startup rather than as an exporter serving nothing.
+func preflight(ctx context.Context, pool string, namespaces []string) error {
+	if _, err := exec.LookPath("rbd"); err != nil {
+		return fmt.Errorf("rbd binary: %w", err)
+	}
+	for _, ns := range append([]string{""}, namespaces...) {
+		spec := pool
+		if ns != "" {
+			spec += "/" + ns
+		}
+		if _, err := RunRBD(ctx, "mirror", "pool", "info", spec, "--format", "json"); err != nil {
+			return fmt.Errorf("access to %s: %w", spec, contextError(ctx, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killOnCancel kills only cmd itself where process groups do not exist.
+func killOnCancel(cmd *exec.Cmd, killed func()) {
+	cmd.Cancel = func() error {
+		killed()
+		return cmd.Process.Kill()
+	}
+}
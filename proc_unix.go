@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killOnCancel starts cmd in its own process group and makes cancellation
+// kill the whole group, so ssh or wrapper children of rbd do not outlive it.
+func killOnCancel(cmd *exec.Cmd, killed func()) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		killed()
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
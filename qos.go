@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// qosLimit is a QoS limit option and the direction of I/O it caps.
+type qosLimit struct {
+	option string
+	op     string
+	bytes  bool // bytes/s, else IOPS
+}
+
+var qosLimits = []qosLimit{
+	{"rbd_qos_iops_limit", "all", false},
+	{"rbd_qos_read_iops_limit", "read", false},
+	{"rbd_qos_write_iops_limit", "write", false},
+	{"rbd_qos_bps_limit", "all", true},
+	{"rbd_qos_read_bps_limit", "read", true},
+	{"rbd_qos_write_bps_limit", "write", true},
+}
+
+// qosCollector exports the QoS limits in effect for an image, wherever they
+// are set: a VM disk crawling at its limit is throttled, not on slow
+// storage.
+type qosCollector struct {
+	descIOPS    *prometheus.Desc
+	descBPS     *prometheus.Desc
+	descLimited *prometheus.Desc
+}
+
+func newQoSCollector(labels []string) imageCollector {
+	limitLabels := append(labels[:len(labels):len(labels)], "op", "source")
+	return &qosCollector{
+		descIOPS:    prometheus.NewDesc(MetricPrefix+"image_qos_limit_iops", "QoS limit of the image in I/O operations per second, by operation (all, read, write) and where it is set (config, pool, image); only set limits", limitLabels, nil),
+		descBPS:     prometheus.NewDesc(MetricPrefix+"image_qos_limit_bytes_per_second", "QoS limit of the image in bytes per second, by operation (all, read, write) and where it is set (config, pool, image); only set limits", limitLabels, nil),
+		descLimited: prometheus.NewDesc(MetricPrefix+"image_qos_limited", "Whether any QoS limit applies to the image (1) or not (0)", labels, nil),
+	}
+}
+
+func (q *qosCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- q.descIOPS
+	ch <- q.descBPS
+	ch <- q.descLimited
+}
+
+// imageConfigEntry is an entry of `rbd config image list --format json`.
+type imageConfigEntry struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// qosSetting is a QoS limit in effect for an image.
+type qosSetting struct {
+	Option string  `json:"option"`
+	Value  float64 `json:"value"`
+	Source string  `json:"source"`
+}
+
+func (q *qosCollector) fetch(ctx context.Context, spec string) (any, error) {
+	var entries []imageConfigEntry
+	if err := runRBDJSON(ctx, &entries, "config", "image", "list", spec, "--format", "json"); err != nil {
+		return nil, err
+	}
+	var set []qosSetting
+	for _, e := range entries {
+		for _, l := range qosLimits {
+			if e.Name != l.option {
+				continue
+			}
+			v, err := strconv.ParseFloat(e.Value, 64)
+			if err != nil {
+				return nil, decodeFailed(fmt.Errorf("parse %s of %s: %w", e.Name, spec, err))
+			}
+			// 0 is unlimited
+			if v > 0 {
+				set = append(set, qosSetting{Option: e.Name, Value: v, Source: e.Source})
+			}
+		}
+	}
+	return set, nil
+}
+
+func (q *qosCollector) collect(ch chan<- prometheus.Metric, labels []string, data any) {
+	set := data.([]qosSetting)
+	for _, s := range set {
+		for _, l := range qosLimits {
+			if s.Option != l.option {
+				continue
+			}
+			desc := q.descIOPS
+			if l.bytes {
+				desc = q.descBPS
+			}
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, s.Value, append(labels[:len(labels):len(labels)], l.op, s.Source)...)
+		}
+	}
+	limited := 0.0
+	if len(set) > 0 {
+		limited = 1
+	}
+	ch <- prometheus.MustNewConstMetric(q.descLimited, prometheus.GaugeValue, limited, labels...)
+}
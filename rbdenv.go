@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultInheritedEnv are the variables rbd gets from the exporter's own
+// environment unless -rbd.inherit-env says otherwise.
+const defaultInheritedEnv = "PATH,HOME,TZ,LANG,LC_ALL,CEPH_ARGS,CEPH_CONF,CEPH_KEYRING"
+
+// rbdEnv is the environment of rbd processes; nil inherits everything.
+var rbdEnv []string
+
+// buildRBDEnv returns the inherited variables named in inherit (those that
+// are set) followed by extra, KEY=VALUE pairs that override them.
+func buildRBDEnv(inherit, extra []string) ([]string, error) {
+	env := make(map[string]string)
+	var order []string
+	set := func(k, v string) {
+		if _, ok := env[k]; !ok {
+			order = append(order, k)
+		}
+		env[k] = v
+	}
+	for _, name := range inherit {
+		if v, ok := os.LookupEnv(name); ok {
+			set(name, v)
+		}
+	}
+	for _, kv := range extra {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("rbd.env: %q is not KEY=VALUE", kv)
+		}
+		set(k, v)
+	}
+	out := make([]string, 0, len(order))
+	for _, k := range order {
+		out = append(out, k+"="+env[k])
+	}
+	return out, nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rbdSubcommands are the rbd and ceph subcommands the exporter runs. They
+// are matched as a whole, so that pools or images named like command words
+// do not end up in the subcommand label.
+var rbdSubcommands = [][]string{
+	{"mirror", "pool", "status"},
+	{"mirror", "pool", "info"},
+	{"mirror", "image", "status"},
+	{"mirror", "snapshot", "schedule", "status"},
+	{"status"},
+	{"info"},
+	{"children"},
+	{"du"},
+	{"ls"},
+	{"snap", "ls"},
+	{"lock", "ls"},
+	{"image-meta", "list"},
+	{"config", "image", "list"},
+	{"trash", "ls"},
+	{"trash", "purge", "schedule", "status"},
+	// ceph
+	{"osd", "blocklist", "ls"},
+	{"config", "get"},
+}
+
+// rbdSubcommand returns the subcommand of an rbd invocation, e.g.
+// "mirror pool status": the longest of rbdSubcommands that args start
+// with, "other" if none.
+func rbdSubcommand(args []string) string {
+	var longest []string
+	for _, sub := range rbdSubcommands {
+		if len(sub) > len(longest) && len(args) >= len(sub) && slices.Equal(args[:len(sub)], sub) {
+			longest = sub
+		}
+	}
+	if longest == nil {
+		return "other"
+	}
+	return strings.Join(longest, " ")
+}
+
+var rbdInvocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: MetricPrefix + "rbd_invocations_total",
+	Help: "rbd processes started, by subcommand",
+}, []string{"subcommand"})
+
+// rbdCounter counts the rbd processes of one refresh.
+type rbdCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+type rbdCounterKey struct{}
+
+// withRBDCounter returns a context counting the rbd processes run with it.
+func withRBDCounter(ctx context.Context) (context.Context, *rbdCounter) {
+	rc := &rbdCounter{counts: make(map[string]int)}
+	return context.WithValue(ctx, rbdCounterKey{}, rc), rc
+}
+
+// countRBD accounts one invocation of rbd with args.
+func countRBD(ctx context.Context, args []string) {
+	sub := rbdSubcommand(args)
+	rbdInvocations.WithLabelValues(sub).Inc()
+	if rc, ok := ctx.Value(rbdCounterKey{}).(*rbdCounter); ok {
+		rc.mu.Lock()
+		rc.counts[sub]++
+		rc.mu.Unlock()
+	}
+}
+
+func (rc *rbdCounter) snapshot() map[string]int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return maps.Clone(rc.counts)
+}
+
+// rbdWarningClasses classify stderr lines by the first substring, matched
+// case-insensitively, found in them, checked in order.
+var rbdWarningClasses = []struct {
+	class    string
+	patterns []string
+}{
+	{"timeout", []string{"timed out", "timeout"}},
+	{"auth", []string{"permission denied", "operation not permitted", "authenticat", "keyring", "cephx"}},
+	{"connection", []string{"connection refused", "unable to connect", "no route to host", "failed to connect"}},
+	{"deprecated", []string{"deprecated", "deprecation"}},
+	{"other", []string{"warn"}},
+}
+
+var rbdWarnings = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: MetricPrefix + "rbd_stderr_warnings_total",
+	Help: "rbd invocations whose stderr mentioned a problem, successful ones included, by subcommand and class",
+}, []string{"subcommand", "class"})
+
+// stderrClasses returns the warning classes found in an rbd stderr, each
+// once.
+func stderrClasses(stderr string) []string {
+	var classes []string
+	for _, line := range strings.Split(strings.ToLower(stderr), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		for _, wc := range rbdWarningClasses {
+			if slices.ContainsFunc(wc.patterns, func(p string) bool { return strings.Contains(line, p) }) {
+				if !slices.Contains(classes, wc.class) {
+					classes = append(classes, wc.class)
+				}
+				break
+			}
+		}
+	}
+	return classes
+}
+
+// countWarnings accounts the warnings in the stderr of rbd run with args.
+func countWarnings(args []string, stderr string) {
+	for _, class := range stderrClasses(stderr) {
+		rbdWarnings.WithLabelValues(rbdSubcommand(args), class).Inc()
+	}
+}
+
+var rbdOutputTruncated = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: MetricPrefix + "rbd_output_truncated_total",
+	Help: "rbd and ceph runs failed for printing more than -rbd.max-output bytes, by subcommand",
+}, []string{"subcommand"})
+
+// errOutputTruncated is returned for runs printing more than -rbd.max-output.
+var errOutputTruncated = errors.New("output truncated")
+
+var rbdKilled = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: MetricPrefix + "rbd_commands_killed_total",
+	Help: "rbd and ceph runs killed, with their process group, for outlasting the collection, by subcommand",
+}, []string{"subcommand"})
+
+var rbdErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: MetricPrefix + "rbd_errors_total",
+	Help: "Failed rbd and ceph runs, by class: timeout, truncated, permission_denied, pool_not_found, connection_refused, json_parse or other",
+}, []string{"class"})
+
+// rbdFailureClasses classify a failed run by the first substring, matched
+// case-insensitively, found in its error message, checked in order.
+var rbdFailureClasses = []struct {
+	class    string
+	patterns []string
+}{
+	{"timeout", []string{"timed out", "(110)"}},
+	{"permission_denied", []string{"permission denied", "operation not permitted", "(13)"}},
+	{"pool_not_found", []string{"error opening pool", "pool does not exist", "pool doesn't exist"}},
+	{"connection_refused", []string{"connection refused", "(111)"}},
+}
+
+// rbdFailureClass buckets the error of a run; killed runs only report the
+// signal, so an expired ctx takes precedence.
+func rbdFailureClass(ctx context.Context, err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, errOutputTruncated):
+		return "truncated"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return "json_parse"
+	}
+	msg := strings.ToLower(err.Error())
+	for _, fc := range rbdFailureClasses {
+		if slices.ContainsFunc(fc.patterns, func(p string) bool { return strings.Contains(msg, p) }) {
+			return fc.class
+		}
+	}
+	return "other"
+}
+
+// decodeFailed counts err, from decoding the output of a successful run
+// outside of runRBDJSON, as a JSON parse failure and returns it.
+func decodeFailed(err error) error {
+	if err != nil {
+		rbdErrors.WithLabelValues("json_parse").Inc()
+	}
+	return err
+}
+
+var rbdOutputNoise = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: MetricPrefix + "rbd_output_noise_total",
+	Help: "rbd and ceph runs whose JSON output came with other text around it, by subcommand",
+}, []string{"subcommand"})
+
+// jsonPayload returns the JSON document in out, skipping banners or warnings
+// that some environments print to stdout around it. The document must
+// start a line; clean tells whether out was the bare document.
+func jsonPayload(out []byte) (doc []byte, clean bool) {
+	trimmed := bytes.TrimSpace(out)
+	if len(trimmed) == 0 || json.Valid(trimmed) {
+		return out, true
+	}
+	for line := out; len(line) > 0; {
+		start := bytes.TrimLeft(line, " \t\r")
+		if len(start) > 0 && (start[0] == '{' || start[0] == '[') {
+			var raw json.RawMessage
+			if json.NewDecoder(bytes.NewReader(start)).Decode(&raw) == nil {
+				return raw, false
+			}
+		}
+		i := bytes.IndexByte(line, '\n')
+		if i < 0 {
+			break
+		}
+		line = line[i+1:]
+	}
+	// let the caller's decoding report the error
+	return out, true
+}
+
+// decodeJSONStream decodes the JSON document read from r into v without
+// holding all of the output. Like jsonPayload it skips the lines before the
+// document, which must start a line, and ignores any text after it.
+func decodeJSONStream(args []string, r io.Reader, v any) error {
+	br := jsonReaders.Get().(*bufio.Reader)
+	br.Reset(r)
+	defer func() {
+		br.Reset(nil)
+		jsonReaders.Put(br)
+	}()
+	noise := false
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			break // let the decoder report the empty output
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		br.UnreadByte()
+		if peek, _ := br.Peek(64); startsJSON(peek) {
+			break
+		}
+		// a noise line; drop it
+		noise = true
+		for {
+			if _, err := br.ReadSlice('\n'); err != bufio.ErrBufferFull {
+				break
+			}
+		}
+	}
+	dec := json.NewDecoder(br)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if noise || !onlySpace(dec.Buffered()) || !onlySpace(br) {
+		rbdOutputNoise.WithLabelValues(rbdSubcommand(args)).Inc()
+		if Debug.Load() {
+			log.Printf("[DEBUG] skipped non-JSON output around the result of %s", strings.Join(args, " "))
+		}
+	}
+	return nil
+}
+
+// jsonReaders are the read buffers of decodeJSONStream; one per rbd call
+// adds up with the per-image collectors.
+var jsonReaders = sync.Pool{New: func() any { return bufio.NewReaderSize(nil, 64<<10) }}
+
+// onlySpace reads r to its end, telling whether it held whitespace only.
+func onlySpace(r io.Reader) bool {
+	var buf [512]byte
+	space := true
+	for {
+		n, err := r.Read(buf[:])
+		if space && len(bytes.TrimSpace(buf[:n])) > 0 {
+			space = false
+		}
+		if err != nil {
+			return space
+		}
+	}
+}
+
+// startsJSON tells whether b starts like a JSON object or array, as
+// opposed to text such as "[WARN] ...".
+func startsJSON(b []byte) bool {
+	if len(b) == 0 || (b[0] != '{' && b[0] != '[') {
+		return false
+	}
+	rest := bytes.TrimLeft(b[1:], " \t\r\n")
+	if len(rest) == 0 {
+		return true // can't tell this early; the decoder will
+	}
+	if b[0] == '{' {
+		return rest[0] == '"' || rest[0] == '}'
+	}
+	if strings.IndexByte(`{["-0123456789]`, rest[0]) >= 0 {
+		return true
+	}
+	for _, lit := range []string{"true", "false", "null"} {
+		if bytes.HasPrefix(rest, []byte(lit)) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanJSON strips the noise around the JSON output of a run with args.
+func cleanJSON(args []string, out []byte) []byte {
+	if !slices.Contains(args, "json") {
+		return out
+	}
+	doc, clean := jsonPayload(out)
+	if !clean {
+		rbdOutputNoise.WithLabelValues(rbdSubcommand(args)).Inc()
+		if Debug.Load() {
+			log.Printf("[DEBUG] skipped non-JSON output around the result of %s", strings.Join(args, " "))
+		}
+	}
+	return doc
+}
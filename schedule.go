@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scheduleCollector reports when each image's next scheduled mirror
+// snapshot is due, so that missed schedules can be alerted on with
+// time() - ceph_vm_image_next_scheduled_snapshot_timestamp > N.
+type scheduleCollector struct {
+	descNext *prometheus.Desc
+}
+
+func newScheduleCollector(labels []string) poolCollector {
+	return &scheduleCollector{
+		descNext: prometheus.NewDesc(MetricPrefix+"image_next_scheduled_snapshot_timestamp", "Time the next scheduled mirror snapshot of the image is due (unix)", labels, nil),
+	}
+}
+
+type scheduledImage struct {
+	Image        string `json:"image"` // pool/[namespace/]image
+	ScheduleTime string `json:"schedule_time"`
+}
+
+// decodeScheduleStatus accepts the object with a scheduled_images list as
+// well as the bare list some releases print.
+func decodeScheduleStatus(raw []byte) ([]scheduledImage, error) {
+	var list []scheduledImage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var st struct {
+		ScheduledImages []scheduledImage `json:"scheduled_images"`
+	}
+	err := json.Unmarshal(raw, &st)
+	return st.ScheduledImages, err
+}
+
+func (s *scheduleCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.descNext
+}
+
+// fetch returns the next snapshot time by image id.
+func (s *scheduleCollector) fetch(ctx context.Context, pool string, namespaces []string, _ *poolStatus) (any, error) {
+	next := make(map[string]time.Time)
+	for _, ns := range namespaces {
+		args := []string{"mirror", "snapshot", "schedule", "status", "--pool", pool}
+		if ns != "" {
+			args = append(args, "--namespace", ns)
+		}
+		raw, err := RunRBD(ctx, append(args, "--format", "json")...)
+		if err != nil {
+			return nil, err
+		}
+		scheduled, err := decodeScheduleStatus(raw)
+		if err != nil {
+			return nil, decodeFailed(err)
+		}
+		for _, si := range scheduled {
+			t, err := time.ParseInLocation("2006-01-02 15:04:05", si.ScheduleTime, time.Local)
+			if err != nil {
+				continue
+			}
+			next[strings.TrimPrefix(si.Image, pool+"/")] = t
+		}
+	}
+	return next, nil
+}
+
+func (s *scheduleCollector) collect(ch chan<- prometheus.Metric, pool string, data any, imageLabels func(string) []string) {
+	if imageLabels == nil {
+		return
+	}
+	for id, t := range data.(map[string]time.Time) {
+		ch <- prometheus.MustNewConstMetric(s.descNext, prometheus.GaugeValue, float64(t.Unix()), imageLabels(id)...)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// defaultScrapeTimeout bounds collections when the scraper doesn't say how
+// long it waits, and for the push outputs.
+const defaultScrapeTimeout = 15 * time.Second
+
+// scrapeTimeout is the time a collection for r may take: the scraper's
+// X-Prometheus-Scrape-Timeout-Seconds less offset, so that the response
+// still makes it in time.
+func scrapeTimeout(r *http.Request, offset time.Duration) time.Duration {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return defaultScrapeTimeout
+	}
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil || secs <= 0 {
+		return defaultScrapeTimeout
+	}
+	timeout := time.Duration(secs * float64(time.Second))
+	if timeout > offset {
+		timeout -= offset
+	}
+	return timeout
+}
+
+// contextCollector is a collector whose collections can be bounded by a
+// context.
+type contextCollector interface {
+	Describe(ch chan<- *prometheus.Desc)
+	collect(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// boundCollector is a contextCollector tied to one scrape's context.
+type boundCollector struct {
+	contextCollector
+	ctx context.Context
+}
+
+func (b boundCollector) Collect(ch chan<- prometheus.Metric) {
+	b.collect(b.ctx, ch)
+}
+
+// metricsErrorLog logs the errors of the metrics handlers.
+var metricsErrorLog = log.New(log.Writer(), "metrics handler: ", log.Flags())
+
+// metricsHandler serves gatherer plus c, the latter bounded by the scrape's
+// timeout and cancelled, rbd processes included, when the scraper goes
+// away, and with labels added. gatherer must not include c. At most
+// maxInFlight scrapes (0 = unlimited) are served at once, others get a 503,
+// so that scrapes piling up while rbd is slow don't pile up rbd processes.
+// Responses are gzipped as parseCompression's result compress says.
+func metricsHandler(gatherer prometheus.Gatherer, c contextCollector, labels prometheus.Labels, offset time.Duration, maxInFlight, compress int) http.Handler {
+	// the promhttp handler is built per scrape, so its own
+	// MaxRequestsInFlight would not limit anything
+	var inFlight chan struct{}
+	if maxInFlight > 0 {
+		inFlight = make(chan struct{}, maxInFlight)
+	}
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inFlight != nil {
+			select {
+			case inFlight <- struct{}{}:
+				defer func() { <-inFlight }()
+			default:
+				http.Error(w, fmt.Sprintf("Limit of concurrent requests reached (%d), try again later.", maxInFlight), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		timeout := scrapeTimeout(r, offset)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		ctx, sp := startSpan(ctx, "scrape "+r.URL.Path, spanKindServer)
+		sp.set("http.route", r.URL.Path)
+		defer sp.end(nil)
+		reg := prometheus.NewRegistry()
+		prometheus.WrapRegistererWith(labels, reg).MustRegister(boundCollector{c, ctx})
+		var h http.Handler = promhttp.HandlerFor(prometheus.Gatherers{gatherer, reg}, promhttp.HandlerOpts{
+			ErrorLog:           metricsErrorLog,
+			ErrorHandling:      promhttp.ContinueOnError,
+			Registry:           prometheus.DefaultRegisterer,
+			DisableCompression: compress != 0,
+			// a backstop: the collection itself ends with ctx
+			Timeout: timeout + offset,
+		})
+		if compress > 0 {
+			h = gzipAbove(compress, h)
+		}
+		h.ServeHTTP(w, r)
+	}))
+}
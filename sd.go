@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sdTargetGroup is one entry of Prometheus' HTTP service discovery format.
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// sdMetaPrefix starts the discovery labels; being __meta_ ones they are
+// dropped unless relabeled, so they cannot clash with the series' own.
+const sdMetaPrefix = "__meta_ceph_vm_"
+
+// httpSDHandler serves /sd, listing every metrics path of the exporter as
+// a target in http_sd format. The target is the address the client used to
+// reach the exporter.
+func httpSDHandler(pool string, poolLabels prometheus.Labels, metricsPaths []string, detached map[string][]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groups := make([]sdTargetGroup, 0, len(metricsPaths))
+		for _, path := range metricsPaths {
+			labels := map[string]string{
+				"__metrics_path__":        path,
+				sdMetaPrefix + "pool":     pool,
+				sdMetaPrefix + "detached": "false",
+			}
+			if names, ok := detached[path]; ok {
+				labels[sdMetaPrefix+"detached"] = "true"
+				labels[sdMetaPrefix+"collectors"] = strings.Join(names, ",")
+			}
+			for name, value := range poolLabels {
+				labels[sdMetaPrefix+"label_"+name] = value
+			}
+			groups = append(groups, sdTargetGroup{Targets: []string{r.Host}, Labels: labels})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(groups); err != nil {
+			log.Printf("service discovery: %v", err)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// imageSeries holds the per-image label values of an image (pool, image,
+// labeler labels) and the label pairs made from them. A refresh builds them
+// once per image, and every series of the image shares them, where const
+// metrics would each sort and allocate their own pairs on every scrape.
+type imageSeries struct {
+	values []string // len == cap, so appending more labels copies
+	pairs  []*dto.LabelPair
+}
+
+// newImageSeries builds the series of an image with label values; desc is
+// any desc with the per-image labels. Invalid values leave the pairs unset,
+// so that the const metrics report them as before.
+func newImageSeries(desc *prometheus.Desc, values []string) *imageSeries {
+	s := &imageSeries{values: values[:len(values):len(values)]}
+	for _, v := range values {
+		if !utf8.ValidString(v) {
+			return s
+		}
+	}
+	pairs := prometheus.MakeLabelPairs(desc, values)
+	s.pairs = pairs[:len(pairs):len(pairs)]
+	return s
+}
+
+// metric returns a series of desc, which must have the per-image labels
+// and no others.
+func (s *imageSeries) metric(desc *prometheus.Desc, vt prometheus.ValueType, v float64) prometheus.Metric {
+	if s.pairs == nil {
+		return prometheus.MustNewConstMetric(desc, vt, v, s.values...)
+	}
+	return &sharedMetric{desc: desc, vt: vt, value: v, pairs: s.pairs}
+}
+
+func (s *imageSeries) gauge(ch chan<- prometheus.Metric, desc *prometheus.Desc, v float64) {
+	ch <- s.metric(desc, prometheus.GaugeValue, v)
+}
+
+func (s *imageSeries) counter(ch chan<- prometheus.Metric, desc *prometheus.Desc, v float64) {
+	ch <- s.metric(desc, prometheus.CounterValue, v)
+}
+
+// with returns the label values followed by more, for descs with labels
+// beyond the per-image ones.
+func (s *imageSeries) with(more ...string) []string {
+	return append(s.values, more...)
+}
+
+// sharedMetric is a const metric with label pairs shared between series.
+// Writers appending labels, like prometheus.WrapRegistererWith, copy them
+// since they are full to capacity.
+type sharedMetric struct {
+	desc  *prometheus.Desc
+	vt    prometheus.ValueType
+	value float64
+	pairs []*dto.LabelPair
+}
+
+func (m *sharedMetric) Desc() *prometheus.Desc { return m.desc }
+
+func (m *sharedMetric) Write(out *dto.Metric) error {
+	out.Label = m.pairs
+	switch m.vt {
+	case prometheus.CounterValue:
+		out.Counter = &dto.Counter{Value: &m.value}
+	case prometheus.GaugeValue:
+		out.Gauge = &dto.Gauge{Value: &m.value}
+	default:
+		out.Untyped = &dto.Untyped{Value: &m.value}
+	}
+	return nil
+}
+
+// buildSeries makes the series of every image in ps, by id.
+func (c *mirrorCollector) buildSeries(ps *poolStatus) map[string]*imageSeries {
+	series := make(map[string]*imageSeries, len(ps.Images))
+	n := 2 + len(c.labeler.Names())
+	for i := range ps.Images {
+		id := ps.Images[i].id()
+		values := make([]string, 0, n)
+		values = append(append(values, c.pool, id), c.labeler.Values(id)...)
+		series[id] = newImageSeries(c.descImagePeers, values)
+	}
+	return series
+}
+
+// seriesOf returns the series of image id from col, building them for an
+// image the refresh did not see.
+func (c *mirrorCollector) seriesOf(col *collection, id string) *imageSeries {
+	if s := col.series[id]; s != nil {
+		return s
+	}
+	return newImageSeries(c.descImagePeers, append([]string{c.pool, id}, c.labeler.Values(id)...))
+}
+
+// labelValues returns the per-image label values of image id, from series
+// if it has them. Callers must not modify them.
+func (c *mirrorCollector) labelValues(series map[string]*imageSeries, id string) []string {
+	if s := series[id]; s != nil {
+		return s.values
+	}
+	return append([]string{c.pool, id}, c.labeler.Values(id)...)
+}
+
+// parseStats decodes the sync stats of every peer in ps once per refresh,
+// rather than on each of the scrapes served from it.
+func parseStats(ps *poolStatus) {
+	for i := range ps.Images {
+		for j := range ps.Images[i].PeerSites {
+			p := &ps.Images[i].PeerSites[j]
+			stats, err := p.decodeStats()
+			p.parsed, p.parseErr = &stats, err
+		}
+	}
+}
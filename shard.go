@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// shard selects the images one of several exporter replicas handles, so
+// that the per-image rbd load of a large pool can be split. Images are
+// assigned by a hash of their vmid label, if there is one, keeping a VM's
+// disks together, or else of their id. Pool-wide series come from shard 0
+// only. A nil shard handles everything.
+type shard struct {
+	index, total int
+	labeler      *imageLabeler
+	vmidIdx      int
+}
+
+func newShard(index, total int, labeler *imageLabeler) (*shard, error) {
+	if total <= 1 && index == 0 {
+		return nil, nil
+	}
+	if total < 1 || index < 0 || index >= total {
+		return nil, fmt.Errorf("shard.index must be in [0, shard.total), got %d of %d", index, total)
+	}
+	s := &shard{index: index, total: total, labeler: labeler, vmidIdx: -1}
+	for i, name := range labeler.Names() {
+		if name == "vmid" {
+			s.vmidIdx = i
+		}
+	}
+	return s, nil
+}
+
+// owns reports whether the image with id belongs to this shard.
+func (s *shard) owns(id string) bool {
+	if s == nil {
+		return true
+	}
+	key := id
+	if s.vmidIdx >= 0 {
+		if vmid := s.labeler.Values(id)[s.vmidIdx]; vmid != "" {
+			key = vmid
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32()%uint32(s.total)) == s.index
+}
+
+// primary reports whether this shard emits the pool-wide series.
+func (s *shard) primary() bool {
+	return s == nil || s.index == 0
+}
+
+// images returns the images of this shard.
+func (s *shard) images(images []poolImage) []poolImage {
+	if s == nil {
+		return images
+	}
+	var out []poolImage
+	for i := range images {
+		if s.owns(images[i].id()) {
+			out = append(out, images[i])
+		}
+	}
+	return out
+}
+
+// status returns ps limited to this shard's images.
+func (s *shard) status(ps *poolStatus) *poolStatus {
+	if s == nil || ps == nil {
+		return ps
+	}
+	return &poolStatus{Images: s.images(ps.Images)}
+}
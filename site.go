@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// siteLookup returns the local site name of a pool's mirroring.
+type siteLookup func(ctx context.Context, pool string) (string, error)
+
+// fetchSiteName reads the site name from rbd mirror pool info.
+func fetchSiteName(ctx context.Context, pool string) (string, error) {
+	var info mirrorPoolInfo
+	if err := runRBDJSON(ctx, &info, "mirror", "pool", "info", pool, "--format", "json"); err != nil {
+		return "", err
+	}
+	return info.SiteName, nil
+}
+
+// siteName caches the site name, which only changes when the cluster is
+// reconfigured; lookups are retried on later refreshes until one succeeds.
+type siteName struct {
+	lookup siteLookup
+
+	mu       sync.Mutex
+	name     string
+	resolved bool // a lookup succeeded, name may still be unset
+	failed   bool // a lookup failed already, logged
+}
+
+func newSiteName(lookup siteLookup) *siteName {
+	return &siteName{lookup: lookup}
+}
+
+// get returns the site name of pool, "" while it is unknown or if the
+// cluster has none set.
+func (s *siteName) get(ctx context.Context, pool string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resolved {
+		return s.name
+	}
+	name, err := s.lookup(ctx, pool)
+	if err != nil {
+		if !s.failed || Debug.Load() {
+			log.Printf("site name: %v", err)
+		}
+		s.failed = true
+		return ""
+	}
+	s.name, s.resolved = name, true
+	return name
+}
+
+// -site-role values: which side of the mirroring the exporter watches
+const (
+	siteRolePrimary   = "primary"   // images are primary here, replayed by the peer
+	siteRoleSecondary = "secondary" // images are replayed here from the peer
+)
+
+func checkSiteRole(role string) error {
+	switch role {
+	case siteRolePrimary, siteRoleSecondary:
+		return nil
+	}
+	return fmt.Errorf("site-role: unknown role %q (want %s or %s)", role, siteRolePrimary, siteRoleSecondary)
+}
+
+// replicationState is the state telling whether img replicates: on the
+// primary site that of the peer replaying it, on the secondary its own,
+// since the local rbd-mirror replays it there while the peer reports
+// up+stopped.
+func (c *mirrorCollector) replicationState(img *poolImage) string {
+	if c.siteRole == siteRoleSecondary {
+		return img.State
+	}
+	return img.PeerSites[0].State
+}
+
+// trackedState is the replication state of img that state change events
+// follow, "" for an image without peers.
+func (c *mirrorCollector) trackedState(img *poolImage) string {
+	if len(img.PeerSites) == 0 {
+		return ""
+	}
+	return c.replicationState(img)
+}
+
+// replicationHealthy tells whether img replicates as expected for the site
+// role: replaying, and in the role of the site's images unless the status
+// does not tell. A primary image on the secondary site, e.g. after a
+// failover, is not healthy.
+func (c *mirrorCollector) replicationHealthy(img *poolImage, state string) bool {
+	if !strings.Contains(state, "replaying") {
+		return false
+	}
+	want := rolePrimary
+	if c.siteRole == siteRoleSecondary {
+		want = roleNonPrimary
+	}
+	role := img.role()
+	return role == "" || role == want
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rbdSnapshot is one entry of `rbd snap ls --all --format json`.
+type rbdSnapshot struct {
+	ID        uint64        `json:"id"`
+	Name      string        `json:"name"`
+	Size      uint64        `json:"size"`
+	Protected string        `json:"protected"`
+	Timestamp string        `json:"timestamp"`
+	Namespace snapNamespace `json:"namespace"`
+}
+
+type snapNamespace struct {
+	Type              string   `json:"type"`
+	State             string   `json:"state"`
+	MirrorPeerUUIDs   []string `json:"mirror_peer_uuids"`
+	Complete          bool     `json:"complete"`
+	PrimaryMirrorUUID string   `json:"primary_mirror_uuid"`
+	PrimarySnapID     uint64   `json:"primary_snap_id"`
+}
+
+func (s *rbdSnapshot) isMirror() bool { return s.Namespace.Type == "mirror" }
+
+// recentSnapshots is the number of newest snapshots per image, of any
+// type, exported one by one, set from -collector.snapshots.recent; 0 turns
+// the per-snapshot series off.
+var recentSnapshots int
+
+// snapshotNameMax caps snapshot name label values; snapshot_id keeps
+// series of truncated names apart.
+const snapshotNameMax = 128
+
+// snapshotCollector reports mirror snapshot IDs and counts from snapshot
+// listings.
+type snapshotCollector struct {
+	descLastCopied *prometheus.Desc
+	descLocal      *prometheus.Desc
+	descRetained   *prometheus.Desc
+	descComplete   *prometheus.Desc
+	descCreated    *prometheus.Desc
+	descSnapSize   *prometheus.Desc
+	descSnapTime   *prometheus.Desc
+	descSnapProt   *prometheus.Desc
+
+	tracker *syncTracker // keeps the snapshotCreation of each image
+}
+
+// snapshotCreation tracks the mirror snapshots of one image across
+// refreshes.
+type snapshotCreation struct {
+	Newest uint64 `json:"newest"` // ID of the newest mirror snapshot seen
+	Count  uint64 `json:"count"`  // created since the image was first seen
+}
+
+// snapshotListing is what the collector fetched for one image.
+type snapshotListing struct {
+	snaps   []rbdSnapshot
+	created uint64
+}
+
+func newSnapshotCollector(labels []string) imageCollector {
+	mp := MetricPrefix
+	snapLabels := append(labels[:len(labels):len(labels)], "snapshot_id", "snapshot", "snapshot_type")
+	return &snapshotCollector{
+		descLastCopied: prometheus.NewDesc(mp+"image_last_copied_snapshot_id", "Primary snapshot ID of the newest complete non-primary mirror snapshot", labels, nil),
+		descLocal:      prometheus.NewDesc(mp+"image_local_latest_snapshot_id", "ID of the newest mirror snapshot in the local cluster", labels, nil),
+		descRetained:   prometheus.NewDesc(mp+"image_mirror_snapshots", "Number of mirror snapshots the image retains; growth means rbd-mirror is not pruning", labels, nil),
+		descComplete:   prometheus.NewDesc(mp+"image_last_mirror_snapshot_complete", "Whether the newest mirror snapshot is completely copied (1) or not (0); while it isn't, the non-primary image recovers to the previous one", labels, nil),
+		descCreated:    prometheus.NewDesc(mp+"image_mirror_snapshots_created_total", "Mirror snapshots that appeared since the exporter first listed the image, kept across restarts with -state.file; snapshots created and pruned between two refreshes are missed", labels, nil),
+		descSnapSize:   prometheus.NewDesc(mp+"snapshot_size_bytes", "Size of one of the image's -collector.snapshots.recent newest snapshots", snapLabels, nil),
+		descSnapTime:   prometheus.NewDesc(mp+"snapshot_timestamp_seconds", "Creation time of one of the image's -collector.snapshots.recent newest snapshots (unix)", snapLabels, nil),
+		descSnapProt:   prometheus.NewDesc(mp+"snapshot_protected", "Whether one of the image's -collector.snapshots.recent newest snapshots is protected (1) or not (0)", snapLabels, nil),
+	}
+}
+
+func (m *snapshotCollector) useTracker(t *syncTracker) { m.tracker = t }
+
+func (m *snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.descLastCopied
+	ch <- m.descLocal
+	ch <- m.descRetained
+	ch <- m.descComplete
+	ch <- m.descCreated
+	ch <- m.descSnapSize
+	ch <- m.descSnapTime
+	ch <- m.descSnapProt
+}
+
+func (m *snapshotCollector) fetch(ctx context.Context, spec string) (any, error) {
+	var snaps []rbdSnapshot
+	if err := runRBDJSON(ctx, &snaps, "snap", "ls", "--all", spec, "--format", "json"); err != nil {
+		return nil, err
+	}
+	return &snapshotListing{snaps, m.countCreated(spec, snaps)}, nil
+}
+
+// countCreated accounts the mirror snapshots newer than the newest one of
+// the previous listing and returns the image's total; the first listing
+// only sets the baseline. IDs only grow, so pruned snapshots do not count.
+func (m *snapshotCollector) countCreated(spec string, snaps []rbdSnapshot) uint64 {
+	pool, image, _ := strings.Cut(spec, "/")
+	var count uint64
+	m.tracker.snapshotCreation(pool, image, func(sc *snapshotCreation, known bool) bool {
+		newest := sc.Newest
+		for i := range snaps {
+			s := &snaps[i]
+			if !s.isMirror() || s.ID <= sc.Newest {
+				continue
+			}
+			if known {
+				sc.Count++
+			}
+			newest = max(newest, s.ID)
+		}
+		changed := !known || newest != sc.Newest
+		sc.Newest, count = newest, sc.Count
+		return changed
+	})
+	return count
+}
+
+func (m *snapshotCollector) collect(ch chan<- prometheus.Metric, labels []string, data any) {
+	listing := data.(*snapshotListing)
+	snaps := listing.snaps
+	ch <- prometheus.MustNewConstMetric(m.descCreated, prometheus.CounterValue, float64(listing.created), labels...)
+	var local, copied uint64
+	var haveLocal, haveCopied, complete bool
+	retained := 0
+	for i := range snaps {
+		s := &snaps[i]
+		if !s.isMirror() {
+			continue
+		}
+		retained++
+		if !haveLocal || s.ID > local {
+			local, haveLocal = s.ID, true
+			complete = s.Namespace.Complete
+		}
+		if s.Namespace.State == "non-primary" && s.Namespace.Complete && (!haveCopied || s.Namespace.PrimarySnapID > copied) {
+			copied, haveCopied = s.Namespace.PrimarySnapID, true
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(m.descRetained, prometheus.GaugeValue, float64(retained), labels...)
+	if haveLocal {
+		ch <- prometheus.MustNewConstMetric(m.descLocal, prometheus.GaugeValue, float64(local), labels...)
+		v := 0.0
+		if complete {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(m.descComplete, prometheus.GaugeValue, v, labels...)
+	}
+	if haveCopied {
+		ch <- prometheus.MustNewConstMetric(m.descLastCopied, prometheus.GaugeValue, float64(copied), labels...)
+	}
+	m.collectRecent(ch, labels, snaps)
+}
+
+// collectRecent emits the per-snapshot series of the recentSnapshots
+// newest snapshots; IDs only grow, so the highest are the newest.
+func (m *snapshotCollector) collectRecent(ch chan<- prometheus.Metric, labels []string, snaps []rbdSnapshot) {
+	if recentSnapshots <= 0 {
+		return
+	}
+	recent := slices.Clone(snaps)
+	slices.SortFunc(recent, func(a, b rbdSnapshot) int { return cmp.Compare(b.ID, a.ID) })
+	snapLabels := append(labels[:len(labels):len(labels)], "", "", "")
+	for _, s := range recent[:min(recentSnapshots, len(recent))] {
+		snapLabels[len(labels)] = strconv.FormatUint(s.ID, 10)
+		snapLabels[len(labels)+1] = sanitizeLabel("snapshot", s.Name, snapshotNameMax)
+		snapLabels[len(labels)+2] = s.Namespace.Type
+		ch <- prometheus.MustNewConstMetric(m.descSnapSize, prometheus.GaugeValue, float64(s.Size), snapLabels...)
+		if t, ok := parseRBDTime(s.Timestamp); ok {
+			ch <- prometheus.MustNewConstMetric(m.descSnapTime, prometheus.GaugeValue, float64(t.Unix()), snapLabels...)
+		}
+		v := 0.0
+		if s.Protected == "true" {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(m.descSnapProt, prometheus.GaugeValue, v, snapLabels...)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsdMaxPacket keeps datagrams below the common Ethernet MTU.
+const statsdMaxPacket = 1432
+
+// statsdOutput sends samples as StatsD gauges over UDP. With tags enabled it
+// uses the DogStatsD "|#tag:value" extension, otherwise labels are folded
+// into the metric name like Graphite paths.
+type statsdOutput struct {
+	address string
+	prefix  string
+	tags    bool
+}
+
+func newStatsdOutput(address, prefix string, tags bool) *statsdOutput {
+	return &statsdOutput{address: address, prefix: strings.Trim(prefix, "."), tags: tags}
+}
+
+func (o *statsdOutput) line(s sample) string {
+	var b strings.Builder
+	b.WriteString(dottedPath(o.prefix, s, !o.tags))
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+	b.WriteString("|g")
+	if o.tags {
+		sep := "|#"
+		for _, l := range s.labels {
+			if l.GetValue() == "" {
+				continue
+			}
+			b.WriteString(sep)
+			b.WriteString(l.GetName())
+			b.WriteByte(':')
+			// commas and pipes separate tags and fields
+			b.WriteString(strings.NewReplacer(",", "_", "|", "_").Replace(l.GetValue()))
+			sep = ","
+		}
+	}
+	return b.String()
+}
+
+// push sends cumulative values as gauges; StatsD counters are deltas and
+// would be double counted.
+func (o *statsdOutput) push(ctx context.Context, now time.Time, samples []sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", o.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, s := range samples {
+		line := o.line(s)
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
@@ -0,0 +1,5 @@
+// Package statuspb holds the generated gRPC bindings for the exporter's
+// replication status service, for use by other Go tooling.
+package statuspb
+
+//go:generate buf generate
@@ -0,0 +1,212 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: status.proto
+
+// Replication status served by ceph_vm_exporter's optional gRPC endpoint
+// (-grpc.listen-address). Regenerate with `go generate ./statuspb`.
+
+package statuspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MirrorStatus_ListImages_FullMethodName        = "/cephvm.status.v1.MirrorStatus/ListImages"
+	MirrorStatus_GetImageStatus_FullMethodName    = "/cephvm.status.v1.MirrorStatus/GetImageStatus"
+	MirrorStatus_WatchStateChanges_FullMethodName = "/cephvm.status.v1.MirrorStatus/WatchStateChanges"
+)
+
+// MirrorStatusClient is the client API for MirrorStatus service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MirrorStatusClient interface {
+	// ListImages returns every mirrored image of the last collection.
+	ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error)
+	// GetImageStatus returns a single image; NotFound if it is unknown.
+	GetImageStatus(ctx context.Context, in *GetImageStatusRequest, opts ...grpc.CallOption) (*ImageStatus, error)
+	// WatchStateChanges streams peer state transitions as collections
+	// detect them.
+	WatchStateChanges(ctx context.Context, in *WatchStateChangesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StateChange], error)
+}
+
+type mirrorStatusClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMirrorStatusClient(cc grpc.ClientConnInterface) MirrorStatusClient {
+	return &mirrorStatusClient{cc}
+}
+
+func (c *mirrorStatusClient) ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListImagesResponse)
+	err := c.cc.Invoke(ctx, MirrorStatus_ListImages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mirrorStatusClient) GetImageStatus(ctx context.Context, in *GetImageStatusRequest, opts ...grpc.CallOption) (*ImageStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImageStatus)
+	err := c.cc.Invoke(ctx, MirrorStatus_GetImageStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mirrorStatusClient) WatchStateChanges(ctx context.Context, in *WatchStateChangesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StateChange], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MirrorStatus_ServiceDesc.Streams[0], MirrorStatus_WatchStateChanges_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchStateChangesRequest, StateChange]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MirrorStatus_WatchStateChangesClient = grpc.ServerStreamingClient[StateChange]
+
+// MirrorStatusServer is the server API for MirrorStatus service.
+// All implementations must embed UnimplementedMirrorStatusServer
+// for forward compatibility.
+type MirrorStatusServer interface {
+	// ListImages returns every mirrored image of the last collection.
+	ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error)
+	// GetImageStatus returns a single image; NotFound if it is unknown.
+	GetImageStatus(context.Context, *GetImageStatusRequest) (*ImageStatus, error)
+	// WatchStateChanges streams peer state transitions as collections
+	// detect them.
+	WatchStateChanges(*WatchStateChangesRequest, grpc.ServerStreamingServer[StateChange]) error
+	mustEmbedUnimplementedMirrorStatusServer()
+}
+
+// UnimplementedMirrorStatusServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMirrorStatusServer struct{}
+
+func (UnimplementedMirrorStatusServer) ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListImages not implemented")
+}
+func (UnimplementedMirrorStatusServer) GetImageStatus(context.Context, *GetImageStatusRequest) (*ImageStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetImageStatus not implemented")
+}
+func (UnimplementedMirrorStatusServer) WatchStateChanges(*WatchStateChangesRequest, grpc.ServerStreamingServer[StateChange]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStateChanges not implemented")
+}
+func (UnimplementedMirrorStatusServer) mustEmbedUnimplementedMirrorStatusServer() {}
+func (UnimplementedMirrorStatusServer) testEmbeddedByValue()                      {}
+
+// UnsafeMirrorStatusServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MirrorStatusServer will
+// result in compilation errors.
+type UnsafeMirrorStatusServer interface {
+	mustEmbedUnimplementedMirrorStatusServer()
+}
+
+func RegisterMirrorStatusServer(s grpc.ServiceRegistrar, srv MirrorStatusServer) {
+	// If the following call pancis, it indicates UnimplementedMirrorStatusServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MirrorStatus_ServiceDesc, srv)
+}
+
+func _MirrorStatus_ListImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListImagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MirrorStatusServer).ListImages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MirrorStatus_ListImages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MirrorStatusServer).ListImages(ctx, req.(*ListImagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MirrorStatus_GetImageStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetImageStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MirrorStatusServer).GetImageStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MirrorStatus_GetImageStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MirrorStatusServer).GetImageStatus(ctx, req.(*GetImageStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MirrorStatus_WatchStateChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStateChangesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MirrorStatusServer).WatchStateChanges(m, &grpc.GenericServerStream[WatchStateChangesRequest, StateChange]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MirrorStatus_WatchStateChangesServer = grpc.ServerStreamingServer[StateChange]
+
+// MirrorStatus_ServiceDesc is the grpc.ServiceDesc for MirrorStatus service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MirrorStatus_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cephvm.status.v1.MirrorStatus",
+	HandlerType: (*MirrorStatusServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListImages",
+			Handler:    _MirrorStatus_ListImages_Handler,
+		},
+		{
+			MethodName: "GetImageStatus",
+			Handler:    _MirrorStatus_GetImageStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchStateChanges",
+			Handler:       _MirrorStatus_WatchStateChanges_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "status.proto",
+}
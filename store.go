@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const stateVersion = 1
+
+// trackerState is the on-disk form of the tracker, written as JSON to
+// -state.file so that counters and baselines survive restarts.
+type trackerState struct {
+	Version    int                               `json:"version"`
+	Buckets    []float64                         `json:"buckets"`
+	Images     map[string]map[string]*imageState `json:"images"`
+	Histograms map[string]*syncHistogram         `json:"histograms"`
+	Churn      map[string]*poolChurn             `json:"churn,omitempty"`
+	// Snapshots are the snapshots collector's creation counts
+	Snapshots map[string]map[string]*snapshotCreation `json:"snapshots,omitempty"`
+}
+
+// load restores the tracker from path; a missing file is not an error.
+func (t *syncTracker) load(path string) error {
+	t.path = path
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st trackerState
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	if st.Version != stateVersion {
+		return fmt.Errorf("%s: unsupported state version %d", path, st.Version)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for pool, images := range st.Images {
+		t.images[pool] = images
+	}
+	for pool, c := range st.Churn {
+		t.churn[pool] = c
+	}
+	for pool, images := range st.Snapshots {
+		t.snapshots[pool] = images
+	}
+	// bucket counts only make sense for the layout they were recorded with
+	if slices.Equal(st.Buckets, t.buckets) {
+		for pool, h := range st.Histograms {
+			t.hists[pool] = h
+		}
+	}
+	return nil
+}
+
+// save writes the tracker to its state file, if any. Caller holds t.mu.
+func (t *syncTracker) save() {
+	t.dirty = false
+	if t.path == "" {
+		return
+	}
+	raw, err := t.marshalLocked()
+	if err == nil {
+		err = writeFileAtomic(t.path, raw)
+	}
+	if err != nil {
+		log.Printf("save state: %v", err)
+	}
+}
+
+func (t *syncTracker) marshalLocked() ([]byte, error) {
+	return json.Marshal(trackerState{
+		Version:    stateVersion,
+		Buckets:    t.buckets,
+		Images:     t.images,
+		Histograms: t.hists,
+		Churn:      t.churn,
+		Snapshots:  t.snapshots,
+	})
+}
+
+// marshal returns the tracker's state as saved to the state file.
+func (t *syncTracker) marshal() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.marshalLocked()
+}
+
+// writeFileAtomic replaces path so that readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
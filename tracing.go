@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tracing exports spans when -tracing.endpoint is set; nil disables it.
+var tracing *tracer
+
+const (
+	tracerBatch    = 512  // spans per export request
+	tracerMaxQueue = 4096 // spans dropped beyond this while the collector is unreachable
+	tracerInterval = 5 * time.Second
+)
+
+// OTLP span kinds and status codes
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+	spanStatusError  = 2
+)
+
+// tracer sends spans to an OTLP/HTTP collector (Tempo, Jaeger, the
+// OpenTelemetry Collector) in the protocol's JSON encoding, in batches.
+type tracer struct {
+	url      string
+	resource []otlpAttr
+	client   *http.Client
+
+	mu      sync.Mutex
+	queue   []*span
+	dropped int
+}
+
+func newTracer(endpoint string) *tracer {
+	if endpoint == "" {
+		return nil
+	}
+	return &tracer{
+		url: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		resource: []otlpAttr{
+			stringAttr("service.name", "ceph_vm_exporter"),
+			stringAttr("service.version", Version),
+		},
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// span is one timed operation; a nil span, from a disabled tracer, ignores
+// every call.
+type span struct {
+	traceID [16]byte
+	spanID  [8]byte
+	parent  [8]byte
+	name    string
+	kind    int
+	start   time.Time
+	finish  time.Time
+	attrs   []otlpAttr
+	err     error
+}
+
+type spanKey struct{}
+
+// startSpan starts a span named name, a child of the span in ctx if there
+// is one, and returns a context carrying it.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	if tracing == nil {
+		return ctx, nil
+	}
+	s := &span{name: name, kind: kind, start: time.Now()}
+	if p, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID, s.parent = p.traceID, p.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *span) set(key, value string) {
+	if s != nil {
+		s.attrs = append(s.attrs, stringAttr(key, value))
+	}
+}
+
+func (s *span) setInt(key string, value int) {
+	if s != nil {
+		s.attrs = append(s.attrs, otlpAttr{Key: key, Value: otlpValue{Int: strconv.Itoa(value)}})
+	}
+}
+
+// end finishes the span, failed if err is not nil, and queues it for export.
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+	s.err, s.finish = err, time.Now()
+	tracing.enqueue(s)
+}
+
+func (t *tracer) enqueue(s *span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.queue) >= tracerMaxQueue {
+		t.dropped++
+		return
+	}
+	t.queue = append(t.queue, s)
+}
+
+// run exports queued spans until ctx is done.
+func (t *tracer) run(ctx context.Context) {
+	tick := time.NewTicker(tracerInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		for t.flush(ctx) {
+		}
+	}
+}
+
+// flush exports one batch and tells whether more are waiting.
+func (t *tracer) flush(ctx context.Context) bool {
+	t.mu.Lock()
+	n := min(len(t.queue), tracerBatch)
+	batch := t.queue[:n:n]
+	t.queue = t.queue[n:]
+	dropped := t.dropped
+	t.dropped = 0
+	more := len(t.queue) > 0
+	t.mu.Unlock()
+	if dropped > 0 {
+		log.Printf("tracing: dropped %d spans", dropped)
+	}
+	if n == 0 {
+		return false
+	}
+	if err := t.export(ctx, batch); err != nil {
+		log.Printf("tracing: %v", err)
+		return false
+	}
+	return more
+}
+
+func (t *tracer) export(ctx context.Context, spans []*span) error {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		out = append(out, s.otlp())
+	}
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": t.resource},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "ceph_vm_exporter", "version": Version},
+				"spans": out,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", t.url, resp.Status)
+	}
+	return nil
+}
+
+// OTLP JSON encoding; ids are hex, 64-bit integers decimal strings.
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    string  `json:"intValue,omitempty"`
+}
+
+func stringAttr(key, value string) otlpAttr {
+	return otlpAttr{Key: key, Value: otlpValue{String: &value}}
+}
+
+type otlpSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+	Status       otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *span) otlp() otlpSpan {
+	o := otlpSpan{
+		TraceID:    hex.EncodeToString(s.traceID[:]),
+		SpanID:     hex.EncodeToString(s.spanID[:]),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+		End:        strconv.FormatInt(s.finish.UnixNano(), 10),
+		Attributes: s.attrs,
+	}
+	if s.parent != [8]byte{} {
+		o.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if s.err != nil {
+		o.Status = otlpStatus{Code: spanStatusError, Message: s.err.Error()}
+	}
+	return o
+}
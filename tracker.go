@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var defaultSyncBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %q: %w", f, err)
+		}
+		buckets = append(buckets, v)
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("no buckets given")
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		return nil, fmt.Errorf("buckets must be in increasing order")
+	}
+	return buckets, nil
+}
+
+func formatBuckets(buckets []float64) string {
+	s := make([]string, len(buckets))
+	for i, b := range buckets {
+		s[i] = strconv.FormatFloat(b, 'g', -1, 64)
+	}
+	return strings.Join(s, ",")
+}
+
+// imageState is what the tracker remembers about an image between refreshes.
+type imageState struct {
+	// LastSnapshot identifies the last snapshot copied to the peer
+	// (its local_snapshot_timestamp); 0 until first seen.
+	LastSnapshot float64 `json:"last_snapshot"`
+	// Syncs counts snapshot copies completed since the baseline.
+	Syncs uint64 `json:"syncs"`
+	// ReplicatedBytes sums the sizes of those copies.
+	ReplicatedBytes float64 `json:"replicated_bytes"`
+	// Resync is whether a resync was requested at the last sighting.
+	Resync bool `json:"resync,omitempty"`
+	// Role is the last known mirror role, see imageRole.
+	Role string `json:"role,omitempty"`
+	// Recent are the syncs of the last replicatedWindow, oldest first.
+	Recent []syncEvent `json:"recent,omitempty"`
+}
+
+// syncEvent is one completed snapshot sync.
+type syncEvent struct {
+	At    int64   `json:"at"` // unix, when the tracker saw it
+	Bytes float64 `json:"bytes"`
+}
+
+// replicatedWindow is the span of the rolling replicated bytes series.
+const replicatedWindow = 24 * time.Hour
+
+// pruneRecent drops the syncs older than the window before now.
+func (st *imageState) pruneRecent(now time.Time) {
+	cutoff := now.Add(-replicatedWindow).Unix()
+	i := 0
+	for i < len(st.Recent) && st.Recent[i].At <= cutoff {
+		i++
+	}
+	st.Recent = st.Recent[i:]
+}
+
+// recentBytes sums the syncs within the window before now.
+func (st *imageState) recentBytes(now time.Time) float64 {
+	st.pruneRecent(now)
+	sum := 0.0
+	for _, e := range st.Recent {
+		sum += e.Bytes
+	}
+	return sum
+}
+
+// mirror roles of an image, from its status
+const (
+	rolePrimary    = "primary"
+	roleNonPrimary = "non-primary"
+)
+
+// imageSighting is what one refresh saw of an image.
+type imageSighting struct {
+	stats  snapshotStats
+	resync bool
+	role   string // "" if the status doesn't tell
+	// peerless images are listed but have lost their peers for now; they
+	// keep their state until they are gone from the listing
+	peerless bool
+}
+
+// syncHistogram is a classic histogram kept by hand so that it can be
+// emitted as a const metric.
+type syncHistogram struct {
+	Counts []uint64 `json:"counts"` // per bucket, not cumulative
+	Count  uint64   `json:"count"`
+	Sum    float64  `json:"sum"`
+}
+
+func (h *syncHistogram) observe(buckets []float64, v float64) {
+	if len(h.Counts) != len(buckets) {
+		h.Counts = make([]uint64, len(buckets))
+	}
+	for i, b := range buckets {
+		if v <= b {
+			h.Counts[i]++
+			break
+		}
+	}
+	h.Count++
+	h.Sum += v
+}
+
+// poolChurn counts changes to a pool's images between refreshes: images
+// appearing in and disappearing from its mirror status, resyncs requested,
+// promotions and demotions.
+type poolChurn struct {
+	Added      uint64 `json:"added"`
+	Removed    uint64 `json:"removed"`
+	Resyncs    uint64 `json:"resyncs,omitempty"`
+	Promotions uint64 `json:"promotions,omitempty"`
+	Demotions  uint64 `json:"demotions,omitempty"`
+}
+
+// syncTracker derives cross-refresh metrics by comparing what each refresh
+// sees with what the previous one saw.
+type syncTracker struct {
+	mu      sync.Mutex
+	buckets []float64
+	labeler *imageLabeler
+	path    string                            // state file, see load
+	images  map[string]map[string]*imageState // pool -> image
+	hists   map[string]*syncHistogram         // pool
+	churn   map[string]*poolChurn             // pool
+	// snapshots are kept for the snapshots collector, pool -> image
+	snapshots map[string]map[string]*snapshotCreation
+	dirty     bool // changed outside of update, not saved yet
+
+	descSyncDuration *prometheus.Desc
+	descSyncs        *prometheus.Desc
+	descReplicated   *prometheus.Desc
+	descAdded        *prometheus.Desc
+	descRemoved      *prometheus.Desc
+	descResyncs      *prometheus.Desc
+	descPromotions   *prometheus.Desc
+	descDemotions    *prometheus.Desc
+	descRecent       *prometheus.Desc
+	descPoolRecent   *prometheus.Desc
+}
+
+func newSyncTracker(buckets []float64, labeler *imageLabeler) *syncTracker {
+	labels := append([]string{"pool", "image"}, labeler.Names()...)
+	return &syncTracker{
+		buckets:          buckets,
+		labeler:          labeler,
+		images:           make(map[string]map[string]*imageState),
+		hists:            make(map[string]*syncHistogram),
+		churn:            make(map[string]*poolChurn),
+		snapshots:        make(map[string]map[string]*snapshotCreation),
+		descSyncDuration: prometheus.NewDesc(MetricPrefix+"snapshot_sync_duration_seconds", "Distribution of completed snapshot sync durations (s)", []string{"pool"}, nil),
+		descSyncs:        prometheus.NewDesc(MetricPrefix+"image_snapshot_syncs_total", "Snapshot syncs to the peer completed since the exporter started tracking the image", labels, nil),
+		descAdded:        prometheus.NewDesc(MetricPrefix+"pool_images_added_total", "Images that appeared in the pool's mirror status", []string{"pool"}, nil),
+		descRemoved:      prometheus.NewDesc(MetricPrefix+"pool_images_removed_total", "Images that disappeared from the pool's mirror status", []string{"pool"}, nil),
+		descResyncs:      prometheus.NewDesc(MetricPrefix+"pool_image_resyncs_total", "Image resync requests seen, counted when an image's status starts reporting one", []string{"pool"}, nil),
+		descPromotions:   prometheus.NewDesc(MetricPrefix+"image_promotions_total", "Promotions seen, counted when an image turns primary between refreshes", []string{"pool"}, nil),
+		descDemotions:    prometheus.NewDesc(MetricPrefix+"image_demotions_total", "Demotions seen, counted when an image turns non-primary between refreshes", []string{"pool"}, nil),
+		descReplicated:   prometheus.NewDesc(MetricPrefix+"image_replicated_bytes_total", "Bytes transferred to the peer by the snapshot syncs counted in image_snapshot_syncs_total", labels, nil),
+		descRecent:       prometheus.NewDesc(MetricPrefix+"image_replicated_24h_bytes", "Bytes transferred to the peer by the snapshot syncs of the last 24 hours, kept across restarts with -state.file", labels, nil),
+		descPoolRecent:   prometheus.NewDesc(MetricPrefix+"pool_replicated_24h_bytes", "Bytes transferred to the peer by the snapshot syncs of the last 24 hours over the images still in the pool", []string{"pool"}, nil),
+	}
+}
+
+// update folds one refresh of pool into the tracker. seen holds every image
+// seen in the refresh; images missing from it are forgotten.
+func (t *syncTracker) update(pool string, seen map[string]imageSighting) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// updated in place, the image set rarely changes between refreshes
+	images, known := t.images[pool]
+	if images == nil {
+		images = make(map[string]*imageState, len(seen))
+		t.images[pool] = images
+	}
+	churn := t.churn[pool]
+	if churn == nil {
+		churn = &poolChurn{}
+		t.churn[pool] = churn
+	}
+	changed := len(images) != len(seen)
+	h := t.hists[pool]
+	if h == nil {
+		h = &syncHistogram{}
+		t.hists[pool] = h
+	}
+	now := time.Now()
+	for name, sighting := range seen {
+		st := images[name]
+		if st == nil {
+			st = &imageState{}
+			images[name] = st
+			changed = true
+			// the first refresh of a pool only establishes the image set
+			if known {
+				churn.Added++
+			}
+		}
+		if sighting.peerless {
+			continue
+		}
+		if sighting.resync != st.Resync {
+			if sighting.resync && known {
+				churn.Resyncs++
+			}
+			st.Resync = sighting.resync
+			changed = true
+		}
+		if sighting.role != "" && sighting.role != st.Role {
+			switch {
+			case st.Role == "":
+				// first sighting, or a state file from before roles
+			case sighting.role == rolePrimary:
+				churn.Promotions++
+			default:
+				churn.Demotions++
+			}
+			st.Role = sighting.role
+			changed = true
+		}
+		s := sighting.stats
+		if s.LocalSnapshotTimestamp == 0 || s.LocalSnapshotTimestamp == st.LastSnapshot {
+			continue
+		}
+		// the first sighting only establishes a baseline
+		if st.LastSnapshot != 0 {
+			h.observe(t.buckets, s.LastSnapshotSyncSeconds)
+			st.Syncs++
+			st.ReplicatedBytes += s.LastSnapshotBytes
+			st.pruneRecent(now)
+			st.Recent = append(st.Recent, syncEvent{now.Unix(), s.LastSnapshotBytes})
+		}
+		st.LastSnapshot = s.LocalSnapshotTimestamp
+		changed = true
+	}
+	for name := range images {
+		if _, ok := seen[name]; !ok {
+			churn.Removed++
+			delete(images, name)
+		}
+	}
+	for name := range t.snapshots[pool] {
+		if _, ok := seen[name]; !ok {
+			delete(t.snapshots[pool], name)
+			changed = true
+		}
+	}
+	if changed || t.dirty {
+		t.save()
+	}
+}
+
+// snapshotCreation calls count with the snapshot creation state of pool's
+// image, under the tracker's lock; known is false for a new state. count
+// tells whether it changed the state, which the next update saves.
+func (t *syncTracker) snapshotCreation(pool, image string, count func(sc *snapshotCreation, known bool) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	images := t.snapshots[pool]
+	if images == nil {
+		images = make(map[string]*snapshotCreation)
+		t.snapshots[pool] = images
+	}
+	sc, known := images[image]
+	if !known {
+		sc = &snapshotCreation{}
+		images[image] = sc
+	}
+	if count(sc, known) {
+		t.dirty = true
+	}
+}
+
+func (t *syncTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.descSyncDuration
+	ch <- t.descSyncs
+	ch <- t.descReplicated
+	ch <- t.descAdded
+	ch <- t.descRemoved
+	ch <- t.descResyncs
+	ch <- t.descPromotions
+	ch <- t.descDemotions
+	ch <- t.descRecent
+	ch <- t.descPoolRecent
+}
+
+// collect emits the tracker's series for pool: per-image ones for the
+// images perImage returns the series of (none if nil), pool level ones if
+// summary.
+func (t *syncTracker) collect(pool string, perImage func(id string) *imageSeries, summary bool, ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	poolRecent := 0.0
+	for name, st := range t.images[pool] {
+		recent := st.recentBytes(now)
+		poolRecent += recent
+		if perImage == nil {
+			continue
+		}
+		series := perImage(name)
+		if series == nil {
+			continue
+		}
+		series.counter(ch, t.descSyncs, float64(st.Syncs))
+		series.counter(ch, t.descReplicated, st.ReplicatedBytes)
+		series.gauge(ch, t.descRecent, recent)
+	}
+	if !summary {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(t.descPoolRecent, prometheus.GaugeValue, poolRecent, pool)
+	if churn := t.churn[pool]; churn != nil {
+		ch <- prometheus.MustNewConstMetric(t.descAdded, prometheus.CounterValue, float64(churn.Added), pool)
+		ch <- prometheus.MustNewConstMetric(t.descRemoved, prometheus.CounterValue, float64(churn.Removed), pool)
+		ch <- prometheus.MustNewConstMetric(t.descResyncs, prometheus.CounterValue, float64(churn.Resyncs), pool)
+		ch <- prometheus.MustNewConstMetric(t.descPromotions, prometheus.CounterValue, float64(churn.Promotions), pool)
+		ch <- prometheus.MustNewConstMetric(t.descDemotions, prometheus.CounterValue, float64(churn.Demotions), pool)
+	}
+	h := t.hists[pool]
+	if h == nil {
+		return
+	}
+	buckets := make(map[float64]uint64, len(t.buckets))
+	var cum uint64
+	for i, b := range t.buckets {
+		if i < len(h.Counts) {
+			cum += h.Counts[i]
+		}
+		buckets[b] = cum
+	}
+	ch <- prometheus.MustNewConstHistogram(t.descSyncDuration, h.Count, h.Sum, buckets, pool)
+}
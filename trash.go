@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// trashCollector reports the trash of each scanned namespace and its purge
+// schedule. Deleted VM disks go to the trash first; a purge schedule that
+// stopped running leaves them there, holding their capacity.
+type trashCollector struct {
+	descImages  *prometheus.Desc
+	descExpired *prometheus.Desc
+	descNext    *prometheus.Desc
+	descLast    *prometheus.Desc
+
+	mu        sync.Mutex
+	expired   map[string]map[string]bool // by pool/namespace, IDs of expired entries
+	lastPurge map[string]time.Time       // by pool/namespace
+}
+
+func newTrashCollector([]string) poolCollector {
+	mp := MetricPrefix
+	labels := []string{"pool", "namespace"}
+	return &trashCollector{
+		descImages:  prometheus.NewDesc(mp+"pool_trash_images", "Images in the trash", labels, nil),
+		descExpired: prometheus.NewDesc(mp+"pool_trash_images_expired", "Images in the trash past their deferment end, due for purging", labels, nil),
+		descNext:    prometheus.NewDesc(mp+"pool_trash_purge_next_timestamp_seconds", "Time the next scheduled trash purge is due (unix)", labels, nil),
+		descLast:    prometheus.NewDesc(mp+"pool_trash_purge_last_timestamp_seconds", "Time a refresh last found images gone from the trash that had been due for purging, by the schedule or by hand; missing until one is seen (unix)", labels, nil),
+		expired:     make(map[string]map[string]bool),
+		lastPurge:   make(map[string]time.Time),
+	}
+}
+
+// trashState is what the collector found for one namespace; NextPurge is
+// zero without a schedule, LastPurge until a purge was seen.
+type trashState struct {
+	Namespace string    `json:"namespace"`
+	Images    int       `json:"images"`
+	Expired   int       `json:"expired"`
+	NextPurge time.Time `json:"next_purge"`
+	LastPurge time.Time `json:"last_purge"`
+}
+
+type trashEntry struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	DefermentEndTime string `json:"deferment_end_time"`
+}
+
+type trashScheduled struct {
+	Namespace    string `json:"namespace"`
+	ScheduleTime string `json:"schedule_time"`
+}
+
+// decodeTrashScheduleStatus accepts the object with a scheduled list as well
+// as the bare list, like decodeScheduleStatus.
+func decodeTrashScheduleStatus(raw []byte) ([]trashScheduled, error) {
+	var list []trashScheduled
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var st struct {
+		Scheduled []trashScheduled `json:"scheduled"`
+	}
+	err := json.Unmarshal(raw, &st)
+	return st.Scheduled, err
+}
+
+func (t *trashCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.descImages
+	ch <- t.descExpired
+	ch <- t.descNext
+	ch <- t.descLast
+}
+
+func (t *trashCollector) fetch(ctx context.Context, pool string, namespaces []string, _ *poolStatus) (any, error) {
+	now := time.Now()
+	out := make([]trashState, 0, len(namespaces))
+	for _, ns := range namespaces {
+		spec := []string{"--pool", pool}
+		if ns != "" {
+			spec = append(spec, "--namespace", ns)
+		}
+		st := trashState{Namespace: ns}
+		raw, err := RunRBD(ctx, append(append([]string{"trash", "ls"}, spec...), "--all", "--long", "--format", "json")...)
+		if err != nil {
+			return nil, err
+		}
+		var entries []trashEntry
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, decodeFailed(fmt.Errorf("decode trash of %s: %w", pool, err))
+		}
+		st.Images = len(entries)
+		expired := make(map[string]bool)
+		for _, e := range entries {
+			end, err := time.ParseInLocation(time.ANSIC, strings.TrimSpace(e.DefermentEndTime), time.Local)
+			if err == nil && end.Before(now) {
+				st.Expired++
+				expired[e.ID] = true
+			}
+		}
+		st.LastPurge = t.notePurges(pool+"/"+ns, entries, expired, now)
+		if raw, err = RunRBD(ctx, append(append([]string{"trash", "purge", "schedule", "status"}, spec...), "--format", "json")...); err != nil {
+			return nil, err
+		}
+		scheduled, err := decodeTrashScheduleStatus(raw)
+		if err != nil {
+			return nil, decodeFailed(fmt.Errorf("decode trash purge schedule status of %s: %w", pool, err))
+		}
+		for _, s := range scheduled {
+			if s.Namespace != ns {
+				continue
+			}
+			if next, err := time.ParseInLocation("2006-01-02 15:04:05", s.ScheduleTime, time.Local); err == nil {
+				st.NextPurge = next
+			}
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// notePurges records the expired entries of a namespace and returns when
+// entries expired at the previous refresh were last found gone. rbd does not
+// tell when a purge ran; this is the refresh that noticed one.
+func (t *trashCollector) notePurges(key string, entries []trashEntry, expired map[string]bool, now time.Time) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if prev := t.expired[key]; len(prev) > 0 {
+		present := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			present[e.ID] = true
+		}
+		for id := range prev {
+			if !present[id] {
+				t.lastPurge[key] = now
+				break
+			}
+		}
+	}
+	t.expired[key] = expired
+	return t.lastPurge[key]
+}
+
+func (t *trashCollector) collect(ch chan<- prometheus.Metric, pool string, data any, _ func(string) []string) {
+	for _, st := range data.([]trashState) {
+		ch <- prometheus.MustNewConstMetric(t.descImages, prometheus.GaugeValue, float64(st.Images), pool, st.Namespace)
+		ch <- prometheus.MustNewConstMetric(t.descExpired, prometheus.GaugeValue, float64(st.Expired), pool, st.Namespace)
+		if !st.NextPurge.IsZero() {
+			ch <- prometheus.MustNewConstMetric(t.descNext, prometheus.GaugeValue, float64(st.NextPurge.Unix()), pool, st.Namespace)
+		}
+		if !st.LastPurge.IsZero() {
+			ch <- prometheus.MustNewConstMetric(t.descLast, prometheus.GaugeValue, float64(st.LastPurge.Unix()), pool, st.Namespace)
+		}
+	}
+}
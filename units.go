@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LegacyMiB keeps emitting the original MiB based series next to the base
+// unit ones, for dashboards still using them; set by -legacy-mib-metrics.
+var LegacyMiB = true
+
+// bytesDesc describes a series in bytes and, in legacy mode, its MiB
+// twin under the old name.
+type bytesDesc struct {
+	bytes, mib *prometheus.Desc
+}
+
+// newBytesDesc returns descs for name (bytes, or bytes/s if it ends in
+// _per_second) and legacyName (MiB); help gets the unit appended.
+func newBytesDesc(name, legacyName, help string, labels []string) bytesDesc {
+	rate := ""
+	if strings.HasSuffix(name, "_per_second") {
+		rate = "/s"
+	}
+	d := bytesDesc{bytes: prometheus.NewDesc(MetricPrefix+name, help+" (bytes"+rate+")", labels, nil)}
+	if LegacyMiB {
+		d.mib = prometheus.NewDesc(MetricPrefix+legacyName, help+" (MiB"+rate+"); deprecated, use "+MetricPrefix+name, labels, nil)
+	}
+	return d
+}
+
+func (d bytesDesc) describe(ch chan<- *prometheus.Desc) {
+	ch <- d.bytes
+	if d.mib != nil {
+		ch <- d.mib
+	}
+}
+
+// gauge emits v, in bytes, as both series.
+func (d bytesDesc) gauge(ch chan<- prometheus.Metric, v float64, labels ...string) {
+	ch <- prometheus.MustNewConstMetric(d.bytes, prometheus.GaugeValue, v, labels...)
+	if d.mib != nil {
+		ch <- prometheus.MustNewConstMetric(d.mib, prometheus.GaugeValue, v/1048576, labels...)
+	}
+}
+
+// series emits v, in bytes, as both series of an image.
+func (d bytesDesc) series(ch chan<- prometheus.Metric, s *imageSeries, v float64) {
+	s.gauge(ch, d.bytes, v)
+	if d.mib != nil {
+		s.gauge(ch, d.mib, v/1048576)
+	}
+}
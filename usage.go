@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// usageCollector reports the space used by each image and its snapshots.
+// rbd du is only fast with the fast-diff feature; without it every object
+// is probed, so enable it with care on large pools.
+type usageCollector struct {
+	descProvisioned  *prometheus.Desc
+	descUsed         *prometheus.Desc
+	descSnapshotUsed *prometheus.Desc
+	descSnapshots    *prometheus.Desc
+}
+
+func newUsageCollector(labels []string) imageCollector {
+	mp := MetricPrefix
+	return &usageCollector{
+		descProvisioned:  prometheus.NewDesc(mp+"image_provisioned_bytes", "Provisioned size of the image (bytes)", labels, nil),
+		descUsed:         prometheus.NewDesc(mp+"image_used_bytes", "Space used by the image head (bytes)", labels, nil),
+		descSnapshotUsed: prometheus.NewDesc(mp+"image_snapshot_used_bytes", "Space used by the image's snapshots, as accounted by rbd du (bytes)", labels, nil),
+		descSnapshots:    prometheus.NewDesc(mp+"image_du_snapshots", "Number of snapshots accounted in image_snapshot_used_bytes", labels, nil),
+	}
+}
+
+// diskUsage is the output of `rbd du --format json`: one entry per
+// snapshot plus one without a snapshot name for the head.
+type diskUsage struct {
+	Images []struct {
+		Name            string `json:"name"`
+		Snapshot        string `json:"snapshot"`
+		ProvisionedSize uint64 `json:"provisioned_size"`
+		UsedSize        uint64 `json:"used_size"`
+	} `json:"images"`
+}
+
+func (u *usageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- u.descProvisioned
+	ch <- u.descUsed
+	ch <- u.descSnapshotUsed
+	ch <- u.descSnapshots
+}
+
+func (u *usageCollector) fetch(ctx context.Context, spec string) (any, error) {
+	var du diskUsage
+	err := runRBDJSON(ctx, &du, "du", spec, "--format", "json")
+	return &du, err
+}
+
+func (u *usageCollector) collect(ch chan<- prometheus.Metric, labels []string, data any) {
+	du := data.(*diskUsage)
+	var provisioned, used, snapUsed uint64
+	var snaps int
+	for _, e := range du.Images {
+		if e.Snapshot != "" {
+			snapUsed += e.UsedSize
+			snaps++
+			continue
+		}
+		provisioned, used = e.ProvisionedSize, e.UsedSize
+	}
+	ch <- prometheus.MustNewConstMetric(u.descProvisioned, prometheus.GaugeValue, float64(provisioned), labels...)
+	ch <- prometheus.MustNewConstMetric(u.descUsed, prometheus.GaugeValue, float64(used), labels...)
+	ch <- prometheus.MustNewConstMetric(u.descSnapshotUsed, prometheus.GaugeValue, float64(snapUsed), labels...)
+	ch <- prometheus.MustNewConstMetric(u.descSnapshots, prometheus.GaugeValue, float64(snaps), labels...)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit and BuildDate are set by build flags, like Version; builds without
+// them report the VCS stamp of the Go toolchain, if any.
+var (
+	Commit    = ""
+	BuildDate = ""
+)
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func buildVersion() versionInfo {
+	v := versionInfo{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && v.Commit == "":
+				v.Commit = s.Value
+			case s.Key == "vcs.time" && v.BuildDate == "":
+				v.BuildDate = s.Value
+			}
+		}
+	}
+	return v
+}
+
+func (v versionInfo) String() string {
+	or := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return s
+	}
+	return fmt.Sprintf("ceph_vm_exporter %s (commit %s, built %s, %s)", v.Version, or(v.Commit), or(v.BuildDate), v.GoVersion)
+}
+
+// versionHandler serves the build information as JSON on /version.
+func versionHandler() http.Handler {
+	v := buildVersion()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			log.Printf("version: %v", err)
+		}
+	})
+}
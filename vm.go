@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// -vm.aggregate modes
+const (
+	vmAggregateOff  = "off"
+	vmAggregateAlso = "also"
+	vmAggregateOnly = "only"
+)
+
+func checkVMAggregate(mode string, labeler *imageLabeler) error {
+	switch mode {
+	case vmAggregateOff:
+		return nil
+	case vmAggregateAlso, vmAggregateOnly:
+	default:
+		return fmt.Errorf("vm.aggregate: unknown mode %q", mode)
+	}
+	for _, name := range labeler.Names() {
+		if name == "vmid" {
+			return nil
+		}
+	}
+	return fmt.Errorf("vm.aggregate: image.label-regex must define a vmid group")
+}
+
+// vmAggregator rolls per-image stats up to one series per VM, using the
+// vmid label extracted from image names. With namespaces scanned, VMs are
+// told apart by namespace too, since tenants may reuse VM ids. A nil
+// aggregator is disabled.
+type vmAggregator struct {
+	mode       string
+	vmidIdx    int
+	namespaced bool
+	descDisk   *prometheus.Desc
+	descBPS    bytesDesc
+	descLast   bytesDesc
+	descSync   *prometheus.Desc
+	descLag    *prometheus.Desc
+	descOK     *prometheus.Desc
+}
+
+func newVMAggregator(mode string, labeler *imageLabeler, namespaced bool) *vmAggregator {
+	if mode == "" || mode == vmAggregateOff {
+		return nil
+	}
+	a := &vmAggregator{mode: mode, vmidIdx: -1, namespaced: namespaced}
+	for i, name := range labeler.Names() {
+		if name == "vmid" {
+			a.vmidIdx = i
+		}
+	}
+	labels := []string{"pool", "vmid"}
+	if namespaced {
+		labels = []string{"pool", "namespace", "vmid"}
+	}
+	mp := MetricPrefix
+	a.descDisk = prometheus.NewDesc(mp+"vm_disks", "Number of mirrored disks of the VM", labels, nil)
+	a.descBPS = newBytesDesc("vm_snapshot_average_bytes", "vm_snapshot_bytes_per_snapshot_mib", "Bytes per snapshot summed over the VM's disks", labels)
+	a.descLast = newBytesDesc("vm_snapshot_last_snapshot_bytes", "vm_snapshot_last_snapshot_bytes_mib", "Last snapshot size transferred summed over the VM's disks", labels)
+	a.descSync = prometheus.NewDesc(mp+"vm_snapshot_last_snapshot_sync_seconds", "Longest last snapshot sync among the VM's disks (s)", labels, nil)
+	a.descLag = prometheus.NewDesc(mp+"vm_snapshot_lag_seconds", "Largest gap between the newest primary snapshot and its peer copy among the VM's disks (s)", labels, nil)
+	a.descOK = prometheus.NewDesc(mp+"vm_replication_state", "Replication state of the VM (1=all disks OK, 0=Not OK)", labels, nil)
+	return a
+}
+
+func (a *vmAggregator) only() bool {
+	return a != nil && a.mode == vmAggregateOnly
+}
+
+func (a *vmAggregator) Describe(ch chan<- *prometheus.Desc) {
+	if a == nil {
+		return
+	}
+	ch <- a.descDisk
+	a.descBPS.describe(ch)
+	a.descLast.describe(ch)
+	ch <- a.descSync
+	ch <- a.descLag
+	ch <- a.descOK
+}
+
+type vmTotals struct {
+	disks             int
+	bytesPerSnapshot  float64
+	lastSnapshotBytes float64
+	maxSyncSeconds    float64
+	maxLagSeconds     float64
+	ok                bool
+}
+
+// vmKey identifies a VM; namespace is "" unless namespaces are scanned.
+type vmKey struct {
+	namespace, vmid string
+}
+
+// vmRun accumulates totals for a single collection.
+type vmRun struct {
+	a   *vmAggregator
+	vms map[vmKey]*vmTotals
+}
+
+func (a *vmAggregator) begin() *vmRun {
+	if a == nil {
+		return nil
+	}
+	return &vmRun{a: a, vms: make(map[vmKey]*vmTotals)}
+}
+
+// add accounts one image of namespace; extra are the image's labeler
+// values.
+func (r *vmRun) add(namespace string, extra []string, state string, stats snapshotStats) {
+	if r == nil {
+		return
+	}
+	vmid := extra[r.a.vmidIdx]
+	if vmid == "" {
+		return
+	}
+	key := vmKey{vmid: vmid}
+	if r.a.namespaced {
+		key.namespace = namespace
+	}
+	t := r.vms[key]
+	if t == nil {
+		t = &vmTotals{ok: true}
+		r.vms[key] = t
+	}
+	t.disks++
+	t.bytesPerSnapshot += stats.BytesPerSnapshot
+	t.lastSnapshotBytes += stats.LastSnapshotBytes
+	t.maxSyncSeconds = max(t.maxSyncSeconds, stats.LastSnapshotSyncSeconds)
+	t.maxLagSeconds = max(t.maxLagSeconds, stats.lagSeconds())
+	t.ok = t.ok && strings.Contains(state, "replaying")
+}
+
+func (r *vmRun) collect(pool string, ch chan<- prometheus.Metric) {
+	if r == nil {
+		return
+	}
+	a := r.a
+	for key, t := range r.vms {
+		ok := 0.0
+		if t.ok {
+			ok = 1.0
+		}
+		labels := []string{pool, key.vmid}
+		if a.namespaced {
+			labels = []string{pool, key.namespace, key.vmid}
+		}
+		ch <- prometheus.MustNewConstMetric(a.descDisk, prometheus.GaugeValue, float64(t.disks), labels...)
+		a.descBPS.gauge(ch, t.bytesPerSnapshot, labels...)
+		a.descLast.gauge(ch, t.lastSnapshotBytes, labels...)
+		ch <- prometheus.MustNewConstMetric(a.descSync, prometheus.GaugeValue, t.maxSyncSeconds, labels...)
+		ch <- prometheus.MustNewConstMetric(a.descLag, prometheus.GaugeValue, t.maxLagSeconds, labels...)
+		ch <- prometheus.MustNewConstMetric(a.descOK, prometheus.GaugeValue, ok, labels...)
+	}
+}
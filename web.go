@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+var landingTmpl = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Ceph VM Exporter</title></head>
+<body>
+<h1>Ceph VM Exporter</h1>
+<p>Version {{.Version}}</p>
+{{range .MetricsPaths}}<p><a href="{{.}}">Metrics ({{.}})</a></p>
+{{end}}
+<h2>Configuration</h2>
+<table>
+{{range .Config}}<tr><td><code>-{{.Name}}</code></td><td><code>{{.Value}}</code></td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type configEntry struct {
+	Name, Value string
+}
+
+// landingHandler serves the index page with the effective configuration,
+// secrets redacted.
+func landingHandler(metricsPaths []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		cfg := redactedConfig()
+		entries := make([]configEntry, 0, len(cfg))
+		for name, value := range cfg {
+			entries = append(entries, configEntry{name, value})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := landingTmpl.Execute(w, struct {
+			Version      string
+			MetricsPaths []string
+			Config       []configEntry
+		}{Version, metricsPaths, entries})
+		if err != nil {
+			log.Printf("render landing page: %v", err)
+		}
+	})
+}
+
+// -web.access-log levels
+const (
+	accessLogOff    = "off"
+	accessLogErrors = "errors" // responses with status 400 and above
+	accessLogAll    = "all"
+)
+
+func checkAccessLog(level string) error {
+	switch level {
+	case accessLogOff, accessLogErrors, accessLogAll:
+		return nil
+	}
+	return fmt.Errorf("web.access-log: unknown level %q", level)
+}
+
+// statusRecorder captures the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// accessLog logs the requests to h that level asks for.
+func accessLog(level string, h http.Handler) http.Handler {
+	if level == accessLogOff {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if level == accessLogErrors && rec.status < 400 {
+			return
+		}
+		log.Printf("access: %s %s %s %d %s", r.RemoteAddr, r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}